@@ -25,15 +25,22 @@ import (
 	"os"
 	"time"
 	"viewre/internal/config"
+	"viewre/internal/repository"
 	"viewre/internal/web"
 )
 
 var (
-	listener *net.TCPListener
-	server   *http.Server
+	listener       *net.TCPListener
+	server         *http.Server
+	stopBackground context.CancelFunc
 )
 
 func Start() {
+	var backgroundCtx context.Context
+	backgroundCtx, stopBackground = context.WithCancel(context.Background())
+	go repository.StartFetcher(backgroundCtx)
+	go repository.StartGarbageCollector(backgroundCtx)
+
 	ln, err := net.Listen("tcp", config.Address)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errors.Join(fmt.Errorf("listening to %s", config.Address), err))
@@ -54,6 +61,9 @@ func Start() {
 }
 
 func Stop() {
+	if stopBackground != nil {
+		stopBackground()
+	}
 	if server == nil {
 		if listener == nil {
 			return
@@ -20,8 +20,10 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -32,8 +34,38 @@ var (
 	WorkosApiKey         string
 	WorkosCookiePassword string
 	Production           bool
+	// FetchInterval is how often every repo is fetched in the background.
+	FetchInterval = 5 * time.Minute
+	// CacheDir holds the clones, checkouts and highlighted files.
+	CacheDir string
+	// HighlightCacheDir is the part of CacheDir with the highlighted files.
+	HighlightCacheDir string
+	// CacheQuota is the size in bytes CacheDir may grow to before unused
+	// checkouts and highlighted files are deleted. Zero means no limit.
+	CacheQuota int64
 )
 
+// parseSize reads sizes like 500M or 20G with binary units.
+func parseSize(s string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	unit := int64(1)
+	if len(s) > 0 {
+		if u, ok := units[s[len(s)-1:]]; ok {
+			unit = u
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative size %d", n)
+	}
+	return n * unit, nil
+}
+
 func loadEnv() {
 	if _, err := os.Stat(".env"); err == nil {
 		if f, err := os.Open(".env"); err == nil {
@@ -67,6 +99,39 @@ func init() {
 		}
 	}
 
+	if intervalStr, ok := os.LookupEnv("FETCH_INTERVAL"); ok {
+		if interval, err := time.ParseDuration(intervalStr); err == nil && interval > 0 {
+			FetchInterval = interval
+		} else {
+			fmt.Fprintf(os.Stderr, "Error parsing FETCH_INTERVAL %q: use a duration like 5m\n", intervalStr)
+			os.Exit(1)
+		}
+	}
+
+	if cacheDir, ok := os.LookupEnv("CACHE_DIR"); ok {
+		CacheDir = cacheDir
+	} else if userCacheDir, err := os.UserCacheDir(); err == nil {
+		CacheDir = filepath.Join(userCacheDir, "viewre")
+	} else {
+		CacheDir = ".cache"
+	}
+	if absCacheDir, err := filepath.Abs(CacheDir); err == nil {
+		CacheDir = absCacheDir
+	} else {
+		fmt.Fprintf(os.Stderr, "Error resolving CACHE_DIR: %v\n", err)
+		os.Exit(1)
+	}
+	HighlightCacheDir = filepath.Join(CacheDir, "highlight")
+
+	if quotaStr, ok := os.LookupEnv("CACHE_QUOTA"); ok {
+		if quota, err := parseSize(quotaStr); err == nil {
+			CacheQuota = quota
+		} else {
+			fmt.Fprintf(os.Stderr, "Error parsing CACHE_QUOTA %q: use a size like 20G\n", quotaStr)
+			os.Exit(1)
+		}
+	}
+
 	if originStr, ok := os.LookupEnv("ORIGIN"); ok {
 		Origin = originStr
 	} else {
@@ -32,6 +32,9 @@ type Repo struct {
 	Password      string `json:"password,omitempty"`
 	SshPrivateKey []byte `json:"ssh_private_key,omitempty"`
 	SshPassphrase string `json:"ssh_passphrase,omitempty"`
+	// SigningKeys are the armored GPG and SSH public keys that commit
+	// signatures are verified against.
+	SigningKeys string `json:"signing_keys,omitempty"`
 }
 
 func (r *Repo) Auth() transport.AuthMethod {
@@ -0,0 +1,28 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package db
+
+import "github.com/bloodmagesoftware/speicher"
+
+var UserSettings, _ = speicher.LoadMap[*UserSetting]("data/user_settings.json")
+
+type UserSetting struct {
+	Theme string `json:"theme,omitempty"`
+	// RenameThreshold is the similarity in percent for rename detection, zero
+	// turns it off and nil means the default.
+	RenameThreshold *int `json:"rename_threshold,omitempty"`
+}
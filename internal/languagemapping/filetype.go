@@ -17,16 +17,26 @@
 package languagemapping
 
 import (
+	"bytes"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
+// GetLanguageID detects the language of a file by its name.
+// Exact filenames like "Dockerfile" are checked before the extension.
 func GetLanguageID(filename string) string {
-	ext := filepath.Ext(filename)
+	base := filepath.Base(filename)
+	if id, ok := getLanguageIDByFilename(base); ok {
+		return id
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
 
 	switch ext {
 	case ".lua":
 		return "lua"
-	case ".md", ".mdx":
+	case ".md", ".mdx", ".markdown":
 		return "markdown"
 	case ".cs":
 		return "cs"
@@ -44,35 +54,235 @@ func GetLanguageID(filename string) string {
 		return "go"
 	case ".hs":
 		return "haskell"
-	case ".html":
+	case ".html", ".htm":
 		return "html"
 	case ".java":
 		return "java"
-	case ".js", ".jsx":
+	case ".js", ".jsx", ".mjs", ".cjs":
 		return "javascript"
 	case ".json", ".json5", ".jsonc":
 		return "json"
-	case ".ocaml":
+	case ".ml":
 		return "ocaml"
+	case ".mli":
+		return "ocaml_interface"
 	case ".php":
 		return "php"
-	case ".py":
+	case ".py", ".pyi":
 		return "python"
 	case ".rs":
 		return "rust"
-	case ".rb":
+	case ".rb", ".rake", ".gemspec":
 		return "ruby"
-	case ".ts":
+	case ".ts", ".mts", ".cts":
 		return "typescript"
 	case ".tsx":
 		return "typescriptreact"
 	case ".editorconfig":
 		return "editorconfig"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".sh", ".bash", ".zsh", ".ksh":
+		return "shellscript"
+	case ".sql":
+		return "sql"
+	case ".proto":
+		return "proto"
+	case ".kt", ".kts":
+		return "kotlin"
+	case ".swift":
+		return "swift"
+	case ".zig":
+		return "zig"
+	case ".dockerfile":
+		return "dockerfile"
+	case ".mk", ".mak":
+		return "makefile"
+	case ".just":
+		return "just"
+	case ".xml", ".svg":
+		return "xml"
+	case ".pl", ".pm":
+		return "perl"
+	case ".scala", ".sc":
+		return "scala"
+	case ".templ":
+		return "templ"
 	default:
 		return "plaintext"
 	}
 }
 
+func getLanguageIDByFilename(base string) (string, bool) {
+	switch base {
+	case "Dockerfile", "Containerfile":
+		return "dockerfile", true
+	case "Makefile", "makefile", "GNUmakefile":
+		return "makefile", true
+	case "justfile", "Justfile", ".justfile":
+		return "just", true
+	case "go.mod":
+		return "go.mod", true
+	case "go.sum":
+		return "go.sum", true
+	case "go.work":
+		return "go.work", true
+	case "Gemfile", "Rakefile", "Vagrantfile":
+		return "ruby", true
+	case "Cargo.lock", "Pipfile", "poetry.lock":
+		return "toml", true
+	case ".bashrc", ".bash_profile", ".profile", ".zshrc", "PKGBUILD":
+		return "shellscript", true
+	}
+	switch {
+	case strings.HasPrefix(base, "Dockerfile."), strings.HasPrefix(base, "Containerfile."):
+		return "dockerfile", true
+	case strings.HasPrefix(base, "Makefile."):
+		return "makefile", true
+	}
+	return "", false
+}
+
+// modelineLines is the number of lines at the start and end of a file that
+// are searched for a modeline, like vim does by default.
+const modelineLines = 5
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w.+-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-\s*(?:.*?\bmode:\s*([\w.+-]+)|([\w.+-]+))\s*(?:;.*?)?-\*-`)
+)
+
+// DetectLanguageID detects the language of a file by its name and falls
+// back to the shebang line and modelines in its content.
+func DetectLanguageID(filename string, content []byte) string {
+	if id := GetLanguageID(filename); id != "plaintext" {
+		return id
+	}
+	if id, ok := languageIDFromShebang(content); ok {
+		return id
+	}
+	if id, ok := languageIDFromModeline(content); ok {
+		return id
+	}
+	return "plaintext"
+}
+
+func languageIDFromShebang(content []byte) (string, bool) {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return "", false
+	}
+	line, _, _ := bytes.Cut(content[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return "", false
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+				continue
+			}
+			interpreter = filepath.Base(field)
+			break
+		}
+	}
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+
+	switch interpreter {
+	case "sh", "bash", "zsh", "dash", "ksh", "ash":
+		return "shellscript", true
+	case "node", "nodejs":
+		return "javascript", true
+	case "deno", "bun", "ts-node", "tsx":
+		return "typescript", true
+	case "runhaskell", "runghc", "stack":
+		return "haskell", true
+	case "":
+		return "", false
+	}
+	if id := GetLanguageIDByName(interpreter); id != "plaintext" {
+		return id, true
+	}
+	return "", false
+}
+
+func languageIDFromModeline(content []byte) (string, bool) {
+	lines := bytes.Split(content, []byte("\n"))
+	candidates := lines
+	if len(lines) > 2*modelineLines {
+		candidates = append(lines[:modelineLines:modelineLines], lines[len(lines)-modelineLines:]...)
+	}
+	for _, line := range candidates {
+		var name string
+		if m := vimModeline.FindSubmatch(line); m != nil {
+			name = string(m[1])
+		} else if m := emacsModeline.FindSubmatch(line); m != nil {
+			name = string(m[1]) + string(m[2])
+		} else {
+			continue
+		}
+		if id := GetLanguageIDByName(name); id != "plaintext" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// GetLanguageIDByName resolves a language name as used in markdown code fences,
+// injection queries or modelines, like "js" or "golang", to a language ID.
+func GetLanguageIDByName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := GetParser(name); ok {
+		return name
+	}
+	switch name {
+	case "golang":
+		return "go"
+	case "c#", "csharp":
+		return "cs"
+	case "node", "jsx":
+		return "javascript"
+	case "python3":
+		return "python"
+	case "ml":
+		return "ocaml"
+	case "sh", "bash", "zsh", "shell", "shellscript":
+		return "shellscript"
+	case "docker", "dockerfile":
+		return "dockerfile"
+	case "make", "makefile":
+		return "makefile"
+	case "kotlin":
+		return "kotlin"
+	case "protobuf":
+		return "proto"
+	case "c++":
+		return "cpp"
+	}
+	return GetLanguageID("." + name)
+}
+
+// GetImageContentType returns the MIME type of image formats browsers can display.
+func GetImageContentType(filename string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".png":
+		return "image/png", true
+	case ".jpg", ".jpeg":
+		return "image/jpeg", true
+	case ".gif":
+		return "image/gif", true
+	case ".webp":
+		return "image/webp", true
+	case ".svg":
+		return "image/svg+xml", true
+	default:
+		return "", false
+	}
+}
+
 func GetImplementation(languageID string) (string, bool) {
 	switch languageID {
 	case "go":
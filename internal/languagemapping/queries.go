@@ -0,0 +1,177 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package languagemapping
+
+import (
+	"embed"
+	"strings"
+)
+
+// The query files are copied from the queries directory of each grammar
+// repository (all MIT licensed) because the Go bindings don't export them.
+//
+//go:embed queries
+var queryFiles embed.FS
+
+type HighlightsQuery struct {
+	Source string
+	// FirstPatternWins is set for grammars whose queries list the most specific
+	// pattern first. All other queries are written so that later patterns
+	// override earlier ones for the same node.
+	FirstPatternWins bool
+}
+
+func GetHighlightsQuery(languageID string) (HighlightsQuery, bool) {
+	switch languageID {
+	case "lua":
+		return loadHighlightsQuery(false, "lua/highlights.scm")
+	case "markdown":
+		return loadHighlightsQuery(false, "markdown/highlights.scm")
+	case "markdown_inline":
+		return loadHighlightsQuery(false, "markdown-inline/highlights.scm")
+	case "cs":
+		return loadHighlightsQuery(false, "c-sharp/highlights.scm")
+	case "c":
+		return loadHighlightsQuery(false, "c/highlights.scm")
+	case "cpp":
+		return loadHighlightsQuery(false, "c/highlights.scm", "cpp/highlights.scm")
+	case "css":
+		return loadHighlightsQuery(false, "css/highlights.scm")
+	case "erb", "ejs":
+		return loadHighlightsQuery(false, "embedded-template/highlights.scm")
+	case "go":
+		return loadHighlightsQuery(true, "go/highlights.scm")
+	case "haskell":
+		return loadHighlightsQuery(false, "haskell/highlights.scm")
+	case "html":
+		return loadHighlightsQuery(false, "html/highlights.scm")
+	case "java":
+		return loadHighlightsQuery(false, "java/highlights.scm")
+	case "javascript":
+		return loadHighlightsQuery(false, "javascript/highlights.scm", "javascript/highlights-jsx.scm", "javascript/highlights-params.scm")
+	case "json":
+		return loadHighlightsQuery(false, "json/highlights.scm")
+	case "ocaml":
+		return loadHighlightsQuery(false, "ocaml/highlights.scm")
+	case "ocaml_interface":
+		return loadHighlightsQuery(false, "ocaml-interface/highlights.scm")
+	case "php":
+		return loadHighlightsQuery(false, "php/highlights.scm")
+	case "python":
+		return loadHighlightsQuery(false, "python/highlights.scm")
+	case "rust":
+		return loadHighlightsQuery(true, "rust/highlights.scm")
+	case "ruby":
+		return loadHighlightsQuery(false, "ruby/highlights.scm")
+	case "typescript":
+		return loadHighlightsQuery(false, "javascript/highlights.scm", "typescript/highlights.scm")
+	case "typescriptreact":
+		return loadHighlightsQuery(false, "javascript/highlights.scm", "javascript/highlights-jsx.scm", "typescript/highlights.scm")
+	default:
+		return HighlightsQuery{}, false
+	}
+}
+
+// GetInjectionsQuery returns the query that finds regions of embedded code
+// that should be parsed with another grammar.
+func GetInjectionsQuery(languageID string) (string, bool) {
+	switch languageID {
+	case "lua":
+		return loadQuery("lua/injections.scm")
+	case "markdown":
+		return loadQuery("markdown/injections.scm")
+	case "markdown_inline":
+		return loadQuery("markdown-inline/injections.scm")
+	case "cpp":
+		return loadQuery("cpp/injections.scm")
+	case "erb":
+		return loadQuery("embedded-template/injections-erb.scm")
+	case "ejs":
+		return loadQuery("embedded-template/injections-ejs.scm")
+	case "haskell":
+		return loadQuery("haskell/injections.scm")
+	case "html":
+		return loadQuery("html/injections.scm")
+	case "javascript", "typescript", "typescriptreact":
+		return loadQuery("javascript/injections.scm")
+	case "php":
+		return loadQuery("php/injections.scm", "php/injections-text.scm")
+	default:
+		return "", false
+	}
+}
+
+// GetTagsQuery returns the query that captures the definitions of a language
+// as @definition.<kind> with their name as @name.
+func GetTagsQuery(languageID string) (string, bool) {
+	switch languageID {
+	case "lua":
+		return loadQuery("lua/tags.scm")
+	case "cs":
+		return loadQuery("c-sharp/tags.scm")
+	case "c":
+		return loadQuery("c/tags.scm")
+	case "cpp":
+		return loadQuery("cpp/tags.scm")
+	case "go":
+		return loadQuery("go/tags.scm")
+	case "haskell":
+		return loadQuery("haskell/tags.scm")
+	case "java":
+		return loadQuery("java/tags.scm")
+	case "javascript":
+		return loadQuery("javascript/tags.scm")
+	case "ocaml", "ocaml_interface":
+		return loadQuery("ocaml/tags.scm")
+	case "php":
+		return loadQuery("php/tags.scm")
+	case "python":
+		return loadQuery("python/tags.scm")
+	case "rust":
+		return loadQuery("rust/tags.scm")
+	case "ruby":
+		return loadQuery("ruby/tags.scm")
+	case "typescript", "typescriptreact":
+		return loadQuery("javascript/tags.scm", "typescript/tags.scm")
+	default:
+		return "", false
+	}
+}
+
+func loadHighlightsQuery(firstPatternWins bool, files ...string) (HighlightsQuery, bool) {
+	source, ok := loadQuery(files...)
+	if !ok {
+		return HighlightsQuery{}, false
+	}
+	return HighlightsQuery{
+		Source:           source,
+		FirstPatternWins: firstPatternWins,
+	}, true
+}
+
+func loadQuery(files ...string) (string, bool) {
+	sourceBuilder := strings.Builder{}
+	for _, file := range files {
+		b, err := queryFiles.ReadFile("queries/" + file)
+		if err != nil {
+			return "", false
+		}
+		sourceBuilder.Write(b)
+		sourceBuilder.WriteString("\n")
+	}
+	return sourceBuilder.String(), true
+}
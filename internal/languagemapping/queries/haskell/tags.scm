@@ -0,0 +1,25 @@
+; The Haskell grammar has no tags query, these patterns only capture top-level
+; definitions. Functions with several equations are captured once per equation.
+
+(declarations
+  (function
+    name: (variable) @name) @definition.function)
+
+(declarations
+  (bind
+    name: (variable) @name) @definition.function)
+
+(data_type
+  name: (name) @name) @definition.type
+
+(newtype
+  name: (name) @name) @definition.type
+
+(type_synomym
+  name: (name) @name) @definition.type
+
+(type_family
+  name: (name) @name) @definition.type
+
+(class
+  name: (name) @name) @definition.interface
@@ -19,6 +19,7 @@ package lsp
 import (
 	"fmt"
 	"log"
+	"path/filepath"
 	"sync"
 	"time"
 	"viewre/internal/languagemapping"
@@ -73,6 +74,18 @@ func GetServer(language string, rootDir string) (LanguageServer, error) {
 	return client, nil
 }
 
+// InUse reports whether a language server is running in rootDir.
+func InUse(rootDir string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, reg := range runningServers {
+		if reg.rootDir == rootDir {
+			return true
+		}
+	}
+	return false
+}
+
 var idleTimeout = 10 * time.Minute
 
 func stopIdleServers() {
@@ -91,6 +104,19 @@ func stopIdleServers() {
 	}
 }
 
+// StopIn stops the language servers whose root directory is dir or inside it.
+func StopIn(dir string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for key, reg := range runningServers {
+		if rel, err := filepath.Rel(dir, reg.rootDir); err == nil && filepath.IsLocal(rel) {
+			log.Println("stopping server", key)
+			reg.server.Stop()
+			delete(runningServers, key)
+		}
+	}
+}
+
 func StopAll() {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -0,0 +1,151 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package markdown
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+type blockOp int
+
+const (
+	blockEqual blockOp = iota
+	blockDelete
+	blockAdd
+)
+
+type blockEdit struct {
+	op   blockOp
+	from int
+	to   int
+}
+
+// RenderDiff renders the old and new version of a markdown document side by side.
+// Top level blocks that only exist in one version are marked as deleted or added.
+// The resolve functions rewrite relative image sources of either version.
+func RenderDiff(from, to []byte, resolveFromImage, resolveToImage func(src string) string) string {
+	fromBlocks := renderBlocks(from, resolveFromImage)
+	toBlocks := renderBlocks(to, resolveToImage)
+
+	sb := strings.Builder{}
+	sb.WriteString(`<div class="md-diff">`)
+	for _, row := range alignBlocks(diffBlocks(fromBlocks, toBlocks)) {
+		writeBlock(&sb, fromBlocks, row[0], "md-diff__block--delete")
+		writeBlock(&sb, toBlocks, row[1], "md-diff__block--add")
+	}
+	sb.WriteString(`</div>`)
+	return sb.String()
+}
+
+// blockRef points into the block list of one side of the diff.
+type blockRef struct {
+	index   int
+	changed bool
+}
+
+func writeBlock(sb *strings.Builder, blocks []string, ref *blockRef, changedClass string) {
+	if ref == nil {
+		sb.WriteString(`<div class="md-diff__block md-diff__block--space"></div>`)
+		return
+	}
+	if ref.changed {
+		sb.WriteString(`<div class="md-diff__block ` + changedClass + `">`)
+	} else {
+		sb.WriteString(`<div class="md-diff__block">`)
+	}
+	sb.WriteString(blocks[ref.index])
+	sb.WriteString(`</div>`)
+}
+
+// alignBlocks turns the edit script into rows of a left and a right block.
+// Deleted and added blocks next to each other share rows, so a changed
+// paragraph stays next to its old version.
+func alignBlocks(edits []blockEdit) [][2]*blockRef {
+	var rows [][2]*blockRef
+	for i := 0; i < len(edits); {
+		if edits[i].op == blockEqual {
+			rows = append(rows, [2]*blockRef{{index: edits[i].from}, {index: edits[i].to}})
+			i++
+			continue
+		}
+		var deleted, added []*blockRef
+		for ; i < len(edits) && edits[i].op != blockEqual; i++ {
+			if edits[i].op == blockDelete {
+				deleted = append(deleted, &blockRef{index: edits[i].from, changed: true})
+			} else {
+				added = append(added, &blockRef{index: edits[i].to, changed: true})
+			}
+		}
+		for j := 0; j < max(len(deleted), len(added)); j++ {
+			var row [2]*blockRef
+			if j < len(deleted) {
+				row[0] = deleted[j]
+			}
+			if j < len(added) {
+				row[1] = added[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// diffBlocks diffs both block lists with diffmatchpatch, which sees every
+// distinct block as one character.
+func diffBlocks(from, to []string) []blockEdit {
+	keys := make(map[string]rune)
+	encode := func(blocks []string) []rune {
+		runes := make([]rune, len(blocks))
+		for i, block := range blocks {
+			r, ok := keys[block]
+			if !ok {
+				r = rune(len(keys) + 1)
+				if r >= 0xD800 {
+					// skip the surrogate range, which isn't valid in strings
+					r += 0x800
+				}
+				keys[block] = r
+			}
+			runes[i] = r
+		}
+		return runes
+	}
+	fromRunes := encode(from)
+	toRunes := encode(to)
+
+	var edits []blockEdit
+	i, j := 0, 0
+	for _, d := range diffmatchpatch.New().DiffMainRunes(fromRunes, toRunes, false) {
+		for range []rune(d.Text) {
+			switch d.Type {
+			case diffmatchpatch.DiffEqual:
+				edits = append(edits, blockEdit{op: blockEqual, from: i, to: j})
+				i++
+				j++
+			case diffmatchpatch.DiffDelete:
+				edits = append(edits, blockEdit{op: blockDelete, from: i})
+				i++
+			case diffmatchpatch.DiffInsert:
+				edits = append(edits, blockEdit{op: blockAdd, to: j})
+				j++
+			}
+		}
+	}
+	return edits
+}
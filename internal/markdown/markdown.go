@@ -0,0 +1,52 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package markdown
+
+import (
+	gomarkdown "github.com/gomarkdown/markdown"
+	gomdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+func newParser() *parser.Parser {
+	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
+	return parser.NewWithExtensions(extensions)
+}
+
+func newRenderer() *gomdhtml.Renderer {
+	htmlFlags := gomdhtml.CommonFlags | gomdhtml.HrefTargetBlank
+	opts := gomdhtml.RendererOptions{Flags: htmlFlags}
+	return gomdhtml.NewRenderer(opts)
+}
+
+// ToHTML renders markdown to sanitized HTML.
+func ToHTML(md []byte) []byte {
+	doc := newParser().Parse(md)
+	return []byte(Sanitize(string(gomarkdown.Render(doc, newRenderer())), nil))
+}
+
+// renderBlocks renders every top level block of the document on its own.
+func renderBlocks(md []byte, resolveImage func(src string) string) []string {
+	doc := newParser().Parse(md)
+	renderer := newRenderer()
+	children := doc.GetChildren()
+	blocks := make([]string, 0, len(children))
+	for _, child := range children {
+		blocks = append(blocks, Sanitize(string(gomarkdown.Render(child, renderer)), resolveImage))
+	}
+	return blocks
+}
@@ -0,0 +1,197 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedAttributes lists the elements that are kept and their allowed attributes.
+// Elements that are not listed are replaced by their children.
+var allowedAttributes = map[atom.Atom][]string{
+	atom.A:          {"href", "title", "target"},
+	atom.Abbr:       {"title"},
+	atom.B:          nil,
+	atom.Blockquote: nil,
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Code:       {"class"},
+	atom.Dd:         nil,
+	atom.Del:        nil,
+	atom.Details:    {"open"},
+	atom.Div:        {"align"},
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         {"align"},
+	atom.H2:         {"align"},
+	atom.H3:         {"align"},
+	atom.H4:         {"align"},
+	atom.H5:         {"align"},
+	atom.H6:         {"align"},
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height", "align"},
+	atom.Ins:        nil,
+	atom.Kbd:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start"},
+	atom.P:          {"align"},
+	atom.Pre:        nil,
+	atom.Q:          nil,
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Small:      nil,
+	atom.Span:       nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"align", "colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"align", "colspan", "rowspan"},
+	atom.Thead:      nil,
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+}
+
+// droppedElements are removed together with their content.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Select:   true,
+	atom.Button:   true,
+	atom.Form:     true,
+	atom.Input:    true,
+	atom.Svg:      true,
+	atom.Math:     true,
+	atom.Link:     true,
+	atom.Meta:     true,
+	atom.Base:     true,
+	atom.Title:    true,
+	atom.Head:     true,
+}
+
+var codeClass = regexp.MustCompile(`^language-[\w+-]+$`)
+
+// Sanitize removes all elements and attributes from an HTML fragment that
+// could run scripts or change the page around it.
+// resolveImage may rewrite relative image sources.
+func Sanitize(fragment string, resolveImage func(src string) string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return html.EscapeString(fragment)
+	}
+	sb := strings.Builder{}
+	for _, node := range nodes {
+		for _, clean := range sanitizeNode(node, resolveImage) {
+			_ = html.Render(&sb, clean)
+		}
+	}
+	return sb.String()
+}
+
+// sanitizeNode returns the nodes that replace n in the sanitized tree.
+func sanitizeNode(n *html.Node, resolveImage func(src string) string) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+	if droppedElements[n.DataAtom] {
+		return nil
+	}
+
+	var children []*html.Node
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		children = append(children, sanitizeNode(child, resolveImage)...)
+	}
+
+	allowed, ok := allowedAttributes[n.DataAtom]
+	if !ok || n.DataAtom == 0 {
+		return children
+	}
+
+	clean := &html.Node{Type: html.ElementNode, Data: n.Data, DataAtom: n.DataAtom}
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" || !slices.Contains(allowed, attr.Key) {
+			continue
+		}
+		switch attr.Key {
+		case "href":
+			if !safeUrl(attr.Val, "http", "https", "mailto") {
+				continue
+			}
+		case "src":
+			if !safeUrl(attr.Val, "http", "https") {
+				continue
+			}
+			if resolveImage != nil && isRelative(attr.Val) {
+				attr.Val = resolveImage(attr.Val)
+			}
+		case "target":
+			if attr.Val != "_blank" {
+				continue
+			}
+			clean.Attr = append(clean.Attr, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+		case "class":
+			if !codeClass.MatchString(attr.Val) {
+				continue
+			}
+		}
+		clean.Attr = append(clean.Attr, html.Attribute{Key: attr.Key, Val: attr.Val})
+	}
+	for _, child := range children {
+		clean.AppendChild(child)
+	}
+	return []*html.Node{clean}
+}
+
+// safeUrl allows relative URLs and absolute URLs with one of the schemes.
+func safeUrl(raw string, schemes ...string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || slices.Contains(schemes, strings.ToLower(u.Scheme))
+}
+
+func isRelative(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && u.Scheme == "" && u.Host == "" && !strings.HasPrefix(u.Path, "/") && u.Path != ""
+}
@@ -0,0 +1,306 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"viewre/internal/db"
+	"viewre/internal/languagemapping"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// builtinAttributes are defined by git itself and apply before any .gitattributes file.
+const builtinAttributes = "[attr]binary -diff -merge -text"
+
+// defaultGenerated and defaultVendored follow linguist, so lock files and
+// dependency directories are collapsed without any .gitattributes entry.
+// Like in linguist, the vendored directories match at any depth.
+var (
+	defaultGenerated = []string{
+		"go.sum", "package-lock.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb",
+		"Cargo.lock", "Gemfile.lock", "composer.lock", "poetry.lock", "Pipfile.lock",
+		"*.pb.go", "*_pb2.py", "*_templ.go", "*.min.js", "*.min.css",
+	}
+	defaultVendored = []string{
+		"vendor/", "node_modules/", "third_party/",
+	}
+)
+
+// generatedHeader matches the "Code generated ... DO NOT EDIT." line
+// described in https://go.dev/s/generatedcode, in any comment style.
+var generatedHeader = regexp.MustCompile(`(?m)^\W*Code generated .* DO NOT EDIT\.?\W*$`)
+
+// generatedHeaderLines is the number of lines searched for the generated header.
+const generatedHeaderLines = 10
+
+type FileAttributes struct {
+	Generated bool
+	Vendored  bool
+	// NoDiff is set for files marked -diff or binary.
+	NoDiff bool
+	// Image is set for images, which are compared visually even if they have
+	// no diff.
+	Image bool
+}
+
+// Collapsed reports whether the file should be hidden on the compare page by default.
+func (fa FileAttributes) Collapsed() bool {
+	return fa.Generated || fa.Vendored || (fa.NoDiff && !fa.Image)
+}
+
+func (fa FileAttributes) Label() string {
+	switch {
+	case fa.NoDiff:
+		return "no diff"
+	case fa.Generated:
+		return "generated"
+	case fa.Vendored:
+		return "vendored"
+	default:
+		return ""
+	}
+}
+
+// attributesCache keeps the attributes of recent commits, which never change.
+var attributesCache = newTTLCache[*Attributes](time.Hour, 64)
+
+// Attributes resolves gitattributes with the most specific pattern taking
+// precedence. gitattributes.Matcher can't be used because it lets earlier
+// patterns overwrite later ones.
+type Attributes struct {
+	stack  []gitattributes.MatchAttribute
+	macros map[string]gitattributes.MatchAttribute
+}
+
+// LoadAttributes reads all .gitattributes files of the tree at rev.
+func LoadAttributes(ctx context.Context, repo *db.Repo, rev string) (*Attributes, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return nil, fmt.Errorf("attributes %s: %w", rev, err)
+	}
+	hash := hashes[0]
+	cacheKey := repo.Name + "/" + hash.String()
+	if cached, ok := attributesCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("load commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("load tree of %s: %w", hash, err)
+	}
+
+	builtin, err := gitattributes.ParseAttributesLine(builtinAttributes, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	stack := []gitattributes.MatchAttribute{builtin}
+	stack = append(stack, defaultAttributes()...)
+
+	// git applies .gitattributes files of deeper directories with higher priority
+	var files []string
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("walk tree of %s: %w", hash, err)
+		}
+		if entry.Mode.IsFile() && path.Base(name) == ".gitattributes" {
+			files = append(files, name)
+		}
+	}
+	for depth := 0; len(files) > 0; depth++ {
+		remaining := files[:0]
+		for _, name := range files {
+			if strings.Count(name, "/") != depth {
+				remaining = append(remaining, name)
+				continue
+			}
+			attrs, err := readAttributesFile(tree, name)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, attrs...)
+		}
+		files = remaining
+	}
+
+	macros := make(map[string]gitattributes.MatchAttribute)
+	for _, attr := range stack {
+		if attr.Pattern == nil {
+			macros[attr.Name] = attr
+		}
+	}
+	attrs := &Attributes{stack: stack, macros: macros}
+	attributesCache.set(cacheKey, attrs)
+	return attrs, nil
+}
+
+func defaultAttributes() []gitattributes.MatchAttribute {
+	attrs := make([]gitattributes.MatchAttribute, 0, len(defaultGenerated)+len(defaultVendored))
+	for _, pattern := range defaultGenerated {
+		if attr, err := gitattributes.ParseAttributesLine(pattern+" linguist-generated", nil, false); err == nil {
+			attrs = append(attrs, attr)
+		}
+	}
+	for _, pattern := range defaultVendored {
+		if attr, err := gitattributes.ParseAttributesLine("**/"+pattern+"** linguist-vendored", nil, false); err == nil {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+func readAttributesFile(tree *object.Tree, name string) ([]gitattributes.MatchAttribute, error) {
+	f, err := tree.File(name)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	var domain []string
+	if dir := path.Dir(name); dir != "." {
+		domain = strings.Split(dir, "/")
+	}
+	attrs, err := gitattributes.ReadAttributes(strings.NewReader(content), domain, domain == nil)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return attrs, nil
+}
+
+// Match returns the attributes of the changed file. Files without an explicit
+// linguist-generated attribute are also checked for a generated code header.
+func (a *Attributes) Match(filePatch diff.FilePatch) FileAttributes {
+	from, to := filePatch.Files()
+	name := ""
+	if to != nil {
+		name = to.Path()
+	} else if from != nil {
+		name = from.Path()
+	}
+
+	fa := FileAttributes{Image: isImagePatch(filePatch)}
+	generatedSet := false
+	if a != nil && name != "" {
+		results := a.lookup(strings.Split(name, "/"))
+		if attr, ok := results["linguist-generated"]; ok && !attr.IsUnspecified() {
+			fa.Generated = isTrue(attr)
+			generatedSet = true
+		}
+		if attr, ok := results["linguist-vendored"]; ok {
+			fa.Vendored = isTrue(attr)
+		}
+		if attr, ok := results["diff"]; ok && attr.IsUnset() {
+			fa.NoDiff = true
+		}
+		if attr, ok := results["binary"]; ok && attr.IsSet() {
+			fa.NoDiff = true
+		}
+	}
+	if !generatedSet && hasGeneratedHeader(filePatch) {
+		fa.Generated = true
+	}
+	return fa
+}
+
+func isImagePatch(filePatch diff.FilePatch) bool {
+	from, to := filePatch.Files()
+	for _, f := range []diff.File{from, to} {
+		if f == nil {
+			continue
+		}
+		if _, ok := languagemapping.GetImageContentType(f.Path()); !ok {
+			return false
+		}
+	}
+	return from != nil || to != nil
+}
+
+func (a *Attributes) lookup(path []string) map[string]gitattributes.Attribute {
+	results := make(map[string]gitattributes.Attribute)
+	add := func(attr gitattributes.Attribute) {
+		if _, ok := results[attr.Name()]; !ok {
+			results[attr.Name()] = attr
+		}
+	}
+	for i := len(a.stack) - 1; i >= 0; i-- {
+		if a.stack[i].Pattern == nil || !a.stack[i].Pattern.Match(path) {
+			continue
+		}
+		for _, attr := range a.stack[i].Attributes {
+			add(attr)
+			if macro, ok := a.macros[attr.Name()]; ok && attr.IsSet() {
+				for _, macroAttr := range macro.Attributes {
+					add(macroAttr)
+				}
+			}
+		}
+	}
+	return results
+}
+
+func isTrue(attr gitattributes.Attribute) bool {
+	if attr.IsValueSet() {
+		return attr.Value() == "true"
+	}
+	return attr.IsSet()
+}
+
+// hasGeneratedHeader checks the first lines of the new version of the file.
+func hasGeneratedHeader(filePatch diff.FilePatch) bool {
+	headBuilder := strings.Builder{}
+	lines := 0
+	for _, chunk := range filePatch.Chunks() {
+		_, content := ChunkContent(chunk)
+		for lines < generatedHeaderLines && content != "" {
+			line, rest, _ := strings.Cut(content, "\n")
+			headBuilder.WriteString(line)
+			headBuilder.WriteString("\n")
+			content = rest
+			lines++
+		}
+		if lines >= generatedHeaderLines {
+			break
+		}
+	}
+	return generatedHeader.MatchString(headBuilder.String())
+}
@@ -0,0 +1,88 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// BlameLine is the commit that last changed a line.
+type BlameLine struct {
+	Hash plumbing.Hash
+	// Parent is the first parent of the commit, or the zero hash for a root commit.
+	Parent plumbing.Hash
+	Author string
+	Date   time.Time
+}
+
+// blameCache keeps recent blames, which walk the history of the file and
+// never change for a commit.
+var blameCache = newTTLCache[[]BlameLine](time.Hour, 32)
+
+// Blame returns the commit of every line of the file at path in the tree of rev.
+func Blame(ctx context.Context, repo *db.Repo, rev, path string) ([]BlameLine, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return nil, fmt.Errorf("blame %s: %w", rev, err)
+	}
+	hash := hashes[0]
+	cacheKey := repo.Name + "/" + hash.String() + "/" + path
+	if cached, ok := blameCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("load commit %s: %w", hash, err)
+	}
+	result, err := git.Blame(commit, path)
+	if err != nil {
+		return nil, fmt.Errorf("blame %s at %s: %w", path, hash, err)
+	}
+
+	parents := make(map[plumbing.Hash]plumbing.Hash)
+	lines := make([]BlameLine, len(result.Lines))
+	for i, line := range result.Lines {
+		parent, ok := parents[line.Hash]
+		if !ok {
+			if c, err := r.CommitObject(line.Hash); err == nil && len(c.ParentHashes) > 0 {
+				parent = c.ParentHashes[0]
+			}
+			parents[line.Hash] = parent
+		}
+		lines[i] = BlameLine{
+			Hash:   line.Hash,
+			Parent: parent,
+			Author: line.AuthorName,
+			Date:   line.Date,
+		}
+	}
+	blameCache.set(cacheKey, lines)
+	return lines, nil
+}
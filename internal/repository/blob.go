@@ -0,0 +1,129 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// ReadBlob returns the content of the file at path in the tree of rev.
+func ReadBlob(ctx context.Context, repo *db.Repo, rev string, path string) ([]byte, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", rev, err)
+	}
+	hash := hashes[0]
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("load commit %s: %w", hash, err)
+	}
+	f, err := commit.File(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s at %s: %w", path, hash, err)
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("read %s at %s: %w", path, hash, err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// BlobSize returns the size of a blob object. The zero hash has size 0.
+func BlobSize(ctx context.Context, repo *db.Repo, hash plumbing.Hash) (int64, error) {
+	if hash.IsZero() {
+		return 0, nil
+	}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	blob, err := r.BlobObject(hash)
+	if err != nil {
+		return 0, fmt.Errorf("load blob %s: %w", hash, err)
+	}
+	return blob.Size, nil
+}
+
+// FileSize returns the size of the old and new version of the changed file.
+// Binary patches have no chunks, so their sizes are read from the blobs.
+func FileSize(ctx context.Context, repo *db.Repo, filePatch diff.FilePatch) (fromSize int64, toSize int64) {
+	if filePatch.IsBinary() {
+		from, to := filePatch.Files()
+		if from != nil {
+			fromSize, _ = BlobSize(ctx, repo, from.Hash())
+		}
+		if to != nil {
+			toSize, _ = BlobSize(ctx, repo, to.Hash())
+		}
+		return
+	}
+	for _, chunk := range filePatch.Chunks() {
+		from, to := ChunkContent(chunk)
+		fromSize += int64(len(from))
+		toSize += int64(len(to))
+	}
+	return
+}
+
+// FileContent rebuilds the old and new version of a changed text file from its chunks.
+func FileContent(filePatch diff.FilePatch) (from []byte, to []byte) {
+	fromBuilder := strings.Builder{}
+	toBuilder := strings.Builder{}
+	for _, chunk := range filePatch.Chunks() {
+		from, to := ChunkContent(chunk)
+		fromBuilder.WriteString(from)
+		toBuilder.WriteString(to)
+	}
+	return []byte(fromBuilder.String()), []byte(toBuilder.String())
+}
+
+// FileStats counts the added and deleted lines of a changed file.
+func FileStats(filePatch diff.FilePatch) (added int, deleted int) {
+	for _, chunk := range filePatch.Chunks() {
+		switch chunk.Type() {
+		case diff.Add:
+			added += countLines(chunk.Content())
+		case diff.Delete:
+			deleted += countLines(chunk.Content())
+		}
+	}
+	return
+}
+
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if len(s) > 0 && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
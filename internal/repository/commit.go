@@ -0,0 +1,71 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Commit is everything the commit page shows besides the diff.
+type Commit struct {
+	Hash      plumbing.Hash
+	Parents   []plumbing.Hash
+	Refs      []string
+	Author    object.Signature
+	Committer object.Signature
+	Message   string
+	Signature Signature
+}
+
+// CommitDetails loads the commit rev resolves to and verifies its signature
+// against the signing keys of the repo.
+func CommitDetails(ctx context.Context, repo *db.Repo, rev string) (Commit, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return Commit{}, fmt.Errorf("commit %s: %w", rev, err)
+	}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return Commit{}, err
+	}
+	defer unlock()
+
+	c, err := r.CommitObject(hashes[0])
+	if err != nil {
+		return Commit{}, fmt.Errorf("load commit %s: %w", hashes[0], err)
+	}
+	refs, err := refNames(r)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	return Commit{
+		Hash:      c.Hash,
+		Parents:   c.ParentHashes,
+		Refs:      refs[c.Hash],
+		Author:    c.Author,
+		Committer: c.Committer,
+		Message:   c.Message,
+		Signature: verifySignature(c, repo.SigningKeys),
+	}, nil
+}
@@ -0,0 +1,187 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+	"viewre/internal/config"
+	"viewre/internal/db"
+)
+
+const (
+	// fetchTimeout bounds a single background fetch.
+	fetchTimeout = 10 * time.Minute
+	// maxFetchBackoff is the longest delay after repeated failures, unless
+	// the interval itself is longer.
+	maxFetchBackoff = time.Hour
+)
+
+// FetchStatus is the state of the background fetches of a repo.
+type FetchStatus struct {
+	LastFetched time.Time `json:"last_fetched"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextFetch   time.Time `json:"next_fetch"`
+	Fetching    bool      `json:"fetching"`
+	failures    int
+}
+
+var (
+	fetchStatuses      = make(map[string]*FetchStatus)
+	fetchStatusesMutex = &sync.Mutex{}
+)
+
+// GetFetchStatus returns the fetch state of the repo with the given name.
+func GetFetchStatus(name string) FetchStatus {
+	fetchStatusesMutex.Lock()
+	defer fetchStatusesMutex.Unlock()
+	if status, ok := fetchStatuses[name]; ok {
+		return *status
+	}
+	return FetchStatus{}
+}
+
+// StartFetcher fetches every repo in the background every
+// config.FetchInterval until ctx is done. Failed fetches are retried with
+// exponential backoff.
+func StartFetcher(ctx context.Context) {
+	for {
+		wait := fetchDueRepos(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// FetchNow fetches the repo immediately and resets its schedule.
+func FetchNow(ctx context.Context, repo *db.Repo) (FetchStatus, error) {
+	err := fetchRepo(ctx, repo)
+	return GetFetchStatus(repo.Name), err
+}
+
+// fetchDueRepos fetches the repos that are due and returns the time until
+// the next one is.
+func fetchDueRepos(ctx context.Context) time.Duration {
+	db.Repos.RLock()
+	repos := make(map[string]*db.Repo)
+	for name, repo := range db.Repos.Iterate {
+		repos[name] = repo
+	}
+	db.Repos.RUnlock()
+
+	now := time.Now()
+	var due []*db.Repo
+	wait := config.FetchInterval
+	fetchStatusesMutex.Lock()
+	for name := range fetchStatuses {
+		if _, ok := repos[name]; !ok {
+			delete(fetchStatuses, name)
+		}
+	}
+	for name, repo := range repos {
+		status, ok := fetchStatuses[name]
+		if !ok {
+			// spread the first fetches after startup
+			status = &FetchStatus{NextFetch: now.Add(jitter(config.FetchInterval))}
+			fetchStatuses[name] = status
+		}
+		if until := status.NextFetch.Sub(now); until > 0 {
+			wait = min(wait, until)
+		} else {
+			due = append(due, repo)
+		}
+	}
+	fetchStatusesMutex.Unlock()
+
+	for _, repo := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		if err := fetchRepo(fetchCtx, repo); err != nil {
+			log.Printf("background fetch of %s failed: %v", repo.Name, err)
+		}
+		cancel()
+	}
+	if len(due) > 0 {
+		// fetching took a while, so check again right away
+		return 0
+	}
+	return wait
+}
+
+// fetchRepo fetches all refs of the repo and schedules the next fetch.
+func fetchRepo(ctx context.Context, repo *db.Repo) error {
+	fetchStatusesMutex.Lock()
+	status, ok := fetchStatuses[repo.Name]
+	if !ok {
+		status = &FetchStatus{}
+		fetchStatuses[repo.Name] = status
+	}
+	status.Fetching = true
+	fetchStatusesMutex.Unlock()
+
+	err := func() error {
+		r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return fetchAll(ctx, r, repo)
+	}()
+
+	fetchStatusesMutex.Lock()
+	defer fetchStatusesMutex.Unlock()
+	now := time.Now()
+	status.Fetching = false
+	if err != nil {
+		status.failures++
+		status.LastError = err.Error()
+		status.NextFetch = now.Add(fetchBackoff(status.failures))
+		return err
+	}
+	status.failures = 0
+	status.LastError = ""
+	status.LastFetched = now
+	status.NextFetch = now.Add(config.FetchInterval + jitter(config.FetchInterval))
+	return nil
+}
+
+// fetchBackoff doubles the delay with every failure in a row, starting at a
+// tenth of the interval.
+func fetchBackoff(failures int) time.Duration {
+	limit := max(maxFetchBackoff, config.FetchInterval)
+	delay := config.FetchInterval / 10
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit) + jitter(delay)
+}
+
+// jitter returns a random duration of up to a tenth of d, so that repos
+// don't all fetch at the same time.
+func jitter(d time.Duration) time.Duration {
+	if d < 10 {
+		return 0
+	}
+	return rand.N(d / 10)
+}
@@ -20,200 +20,239 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"html"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strings"
-	"sync"
+	"slices"
+	"time"
 	"viewre/internal/db"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-var mutex = &sync.Mutex{}
-
+// CheckoutCommit writes the files of a commit to their own directory, because
+// language servers need a worktree. The files are read from the mirror and
+// written only once per commit.
 func CheckoutCommit(ctx context.Context, repo *db.Repo, commitRev string) (string, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	repoPath := filepath.Join(tempDir, repo.Name, commitRev[0:4], commitRev[4:])
-
-	r, err := openGitRepo(ctx, repo, repoPath)
-	if err != nil {
-		return "", err
-	}
-	auth := repo.Auth()
-
-	commitHash, err := ensureRevision(ctx, r, commitRev, auth)
+	hashes, err := resolveRevisions(ctx, repo, commitRev)
 	if err != nil {
-		return "", fmt.Errorf("pull %s: %w", commitRev, err)
+		return "", fmt.Errorf("checkout %s: %w", commitRev, err)
 	}
+	hash := hashes[0].String()
+	repoPath := filepath.Join(reposDir, repo.Name, hash[0:4], hash[4:])
 
-	commitObj, err := r.CommitObject(commitHash)
+	unlock, err := lockPath(ctx, repoPath, true)
 	if err != nil {
-		return "", fmt.Errorf("get commit commit %s: %w", commitHash, err)
+		return "", err
 	}
+	defer unlock()
 
-	w, err := r.Worktree()
-	if err != nil {
-		return "", fmt.Errorf("open worktree: %w", err)
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		if err := writeCheckout(ctx, repo, hashes[0], repoPath); err != nil {
+			return "", fmt.Errorf("checkout %s: %w", commitRev, err)
+		}
 	}
 
-	if err := w.Checkout(&git.CheckoutOptions{
-		Hash:  commitObj.Hash,
-		Force: true,
-	}); err != nil {
-		return "", fmt.Errorf("checkout %s: %w", commitRev, err)
-	}
+	// the modification time tells the garbage collector when the checkout was used last
+	now := time.Now()
+	_ = os.Chtimes(repoPath, now, now)
+	triggerGarbageCollection()
 
 	return repoPath, nil
 }
 
-func Diff(ctx context.Context, repo *db.Repo, baseRef, changeRef string) (string, string, *object.Patch, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	repoPath := filepath.Join(tempDir, repo.Name, "HEAD")
-	r, err := openGitRepo(ctx, repo, repoPath)
+// writeCheckout writes the tree of the commit to a temporary directory that
+// is renamed to dir when it is complete.
+func writeCheckout(ctx context.Context, repo *db.Repo, hash plumbing.Hash, dir string) error {
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
 	if err != nil {
-		return "", "", nil, err
+		return err
 	}
-	auth := repo.Auth()
+	defer unlock()
 
-	baseHash, err := ensureRevision(ctx, r, baseRef, auth)
+	commit, err := r.CommitObject(hash)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("base %s: %w", baseRef, err)
+		return fmt.Errorf("load commit %s: %w", hash, err)
 	}
-	changeHash, err := ensureRevision(ctx, r, changeRef, auth)
+	tree, err := commit.Tree()
 	if err != nil {
-		return "", "", nil, fmt.Errorf("change %s: %w", changeRef, err)
+		return fmt.Errorf("load tree of %s: %w", hash, err)
 	}
 
-	baseCommit, err := r.CommitObject(baseHash)
-	if err != nil {
-		return "", "", nil, fmt.Errorf("load base %s: %w", baseHash, err)
+	tmpDir := dir + checkoutTmpSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
 	}
-	changeCommit, err := r.CommitObject(changeHash)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !filepath.IsLocal(f.Name) {
+			return fmt.Errorf("invalid path %q", f.Name)
+		}
+		return writeCheckoutFile(f, filepath.Join(tmpDir, filepath.FromSlash(f.Name)))
+	})
 	if err != nil {
-		return "", "", nil, fmt.Errorf("load change %s: %w", changeHash, err)
+		_ = os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+func writeCheckoutFile(f *object.File, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", f.Name, err)
+		}
+		return os.Symlink(target, path)
 	}
 
-	patch, err := baseCommit.PatchContext(ctx, changeCommit)
+	perm := os.FileMode(0600)
+	if f.Mode == filemode.Executable {
+		perm = 0700
+	}
+	reader, err := f.Reader()
 	if err != nil {
-		return "", "", nil, fmt.Errorf("diff %s..%s: %w", baseRef, changeRef, err)
+		return fmt.Errorf("read %s: %w", f.Name, err)
 	}
+	defer reader.Close()
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return fmt.Errorf("write %s: %w", f.Name, err)
+	}
+	return out.Close()
+}
 
-	return baseCommit.Hash.String(), changeCommit.Hash.String(), patch, nil
+type DiffOptions struct {
+	// RenameThreshold is the minimum similarity in percent for a file to be
+	// shown as renamed or copied. Zero disables rename detection.
+	RenameThreshold int
+	// IgnoreAllSpace, IgnoreSpaceChange and IgnoreBlankLines work like git's
+	// -w, -b and --ignore-blank-lines. Ignored changes become WhitespaceChunks.
+	IgnoreAllSpace    bool
+	IgnoreSpaceChange bool
+	IgnoreBlankLines  bool
+	// Paths restricts the diff to these files if it isn't empty. Both paths
+	// of a rename have to be listed for it to be detected.
+	Paths []string
 }
 
-var logLineParser = regexp.MustCompile(`([* |\/\\]*[*|\/\\]+) +([a-z0-9]+) +(.+)`)
+type cachedDiff struct {
+	patch   diff.Patch
+	renames Renames
+}
 
-func Log(ctx context.Context, repo *db.Repo) (string, error) {
-	mutex.Lock()
-	defer mutex.Unlock()
+// diffCache keeps recent diffs, because the compare page loads the files of
+// a diff one by one.
+var diffCache = newTTLCache[cachedDiff](5*time.Minute, 16)
 
-	repoPath := filepath.Join(tempDir, repo.Name, "HEAD")
-	r, err := openGitRepo(ctx, repo, repoPath)
+func Diff(ctx context.Context, repo *db.Repo, baseRef, changeRef string, options DiffOptions) (string, string, diff.Patch, Renames, error) {
+	hashes, err := resolveRevisions(ctx, repo, baseRef, changeRef)
 	if err != nil {
-		return "", err
+		return "", "", nil, nil, fmt.Errorf("diff %s..%s: %w", baseRef, changeRef, err)
 	}
-	auth := repo.Auth()
+	baseHash, changeHash := hashes[0], hashes[1]
 
-	remote, err := r.Remote("origin")
-	if err != nil {
-		return "", fmt.Errorf("failed to get remote: %w", err)
+	cacheKey := fmt.Sprintf("%s/%s..%s/%+v", repo.Name, baseHash, changeHash, options)
+	if cached, ok := diffCache.get(cacheKey); ok {
+		return baseHash.String(), changeHash.String(), cached.patch, cached.renames, nil
 	}
 
-	err = remote.Fetch(&git.FetchOptions{
-		RefSpecs: []config.RefSpec{"refs/*:refs/*"},
-		Auth:     auth,
-		Force:    true,
-	})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return "", fmt.Errorf("failed to fetch: %w", err)
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return "", "", nil, nil, err
 	}
+	defer unlock()
 
-	w, err := r.Worktree()
+	baseCommit, err := r.CommitObject(baseHash)
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("load base %s: %w", baseHash, err)
+	}
+	changeCommit, err := r.CommitObject(changeHash)
 	if err != nil {
-		return "", fmt.Errorf("open worktree: %w", err)
+		return "", "", nil, nil, fmt.Errorf("load change %s: %w", changeHash, err)
 	}
 
-	if err := w.Pull(&git.PullOptions{
-		RemoteName: "origin",
-		Auth:       auth,
-		Force:      true,
-	}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
-		return "", fmt.Errorf("pull failed: %w", err)
+	baseTree, err := baseCommit.Tree()
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("load base tree %s: %w", baseHash, err)
+	}
+	changeTree, err := changeCommit.Tree()
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("load change tree %s: %w", changeHash, err)
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "log", "--pretty=oneline", "--graph", "--decorate", "--all", "--branches", "--no-color")
-	cmd.Dir = repoPath
-	out, err := cmd.Output()
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, changeTree, nil)
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("diff %s..%s: %w", baseRef, changeRef, err)
+	}
+	if len(options.Paths) > 0 {
+		changes = filterChanges(changes, options.Paths)
+	}
+	changes, renames, err := detectRenames(ctx, changes, options.RenameThreshold)
 	if err != nil {
-		return "", fmt.Errorf("failed to run git log: %w", err)
+		return "", "", nil, nil, fmt.Errorf("detect renames %s..%s: %w", baseRef, changeRef, err)
 	}
-	lines := strings.Split(string(out), "\n")
 
-	signsBuilder := strings.Builder{}
-	for _, line := range lines {
-		result := logLineParser.FindStringSubmatch(line)
-		if len(result) == 4 {
-			signs := result[1]
-			signsBuilder.WriteString("<p>")
-			signsBuilder.WriteString(replaceSigns(signs))
-			signsBuilder.WriteString("</p>")
-		} else {
-			signsBuilder.WriteString(fmt.Sprintf(`<p>%s</p>`, replaceSigns(line)))
-		}
+	patch, err := changes.PatchContext(ctx)
+	if err != nil {
+		return "", "", nil, nil, fmt.Errorf("diff %s..%s: %w", baseRef, changeRef, err)
 	}
 
-	contentBuilder := strings.Builder{}
-	for _, line := range lines {
-		result := logLineParser.FindStringSubmatch(line)
-		if len(result) == 4 {
-			hash := result[2]
-			text := result[3]
-			contentBuilder.WriteString(fmt.Sprintf(
-				`<p class="whitespace-pre cursor-pointer" data-commit="%s"><span class="text-yellow-500">%s</span> %s</p>`,
-				html.EscapeString(hash),
-				html.EscapeString(hash[0:8]),
-				html.EscapeString(text),
-			))
-		} else {
-			contentBuilder.WriteString("<br>")
-		}
+	result := cachedDiff{
+		patch:   ignoreWhitespace(patch, options),
+		renames: renames,
 	}
+	diffCache.set(cacheKey, result)
 
-	return fmt.Sprintf(`<div class="w-full flex flex-row flex-nowrap"><div class="font-mono text-gray-500">%s</div><div class="overflow-x-auto" id="commits-content">%s</div></div>`, signsBuilder.String(), contentBuilder.String()), nil
+	return baseCommit.Hash.String(), changeCommit.Hash.String(), result.patch, result.renames, nil
 }
 
-func replaceSigns(signs string) string {
-	signsBuilder := strings.Builder{}
-	for _, char := range signs {
-		signsBuilder.WriteString(`<span`)
-		switch char {
-		case '*':
-			signsBuilder.WriteString(` class="commit-sign">│`)
-		case '\\':
-			signsBuilder.WriteString(`>╲`)
-		case '/':
-			signsBuilder.WriteString(`>╱`)
-		case '|':
-			signsBuilder.WriteString(`>│`)
-		case ' ':
-			signsBuilder.WriteString(">&nbsp;")
-		default:
-			signsBuilder.WriteRune(char)
+// filterChanges keeps the changes of the files at paths.
+func filterChanges(changes object.Changes, paths []string) object.Changes {
+	var filtered object.Changes
+	for _, change := range changes {
+		if slices.Contains(paths, change.From.Name) || slices.Contains(paths, change.To.Name) {
+			filtered = append(filtered, change)
 		}
-		signsBuilder.WriteString("</span>")
 	}
-	return signsBuilder.String()
+	return filtered
+}
+
+// mirrorRefSpec updates all refs of the mirror, like git fetch in a
+// repo cloned with --mirror.
+const mirrorRefSpec = config.RefSpec("+refs/*:refs/*")
+
+// fetchAll updates all refs of the mirror and drops deleted ones.
+func fetchAll(ctx context.Context, r *git.Repository, repo *db.Repo) error {
+	err := r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{mirrorRefSpec},
+		Auth:       repo.Auth(),
+		Force:      true,
+		Prune:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	return nil
 }
 
 func ensureRevision(ctx context.Context, r *git.Repository, rev string, auth transport.AuthMethod) (plumbing.Hash, error) {
@@ -225,10 +264,7 @@ func ensureRevision(ctx context.Context, r *git.Repository, rev string, auth tra
 		RemoteName: "origin",
 		Auth:       auth,
 		Force:      true,
-		RefSpecs: []config.RefSpec{
-			"+refs/heads/*:refs/remotes/origin/*",
-			"+refs/tags/*:refs/tags/*",
-		},
+		RefSpecs:   []config.RefSpec{mirrorRefSpec},
 	}); ferr != nil && ferr != git.NoErrAlreadyUpToDate {
 		return plumbing.ZeroHash, fmt.Errorf("fetch failed: %w", ferr)
 	}
@@ -239,16 +275,9 @@ func ensureRevision(ctx context.Context, r *git.Repository, rev string, auth tra
 	return *h, nil
 }
 
-func openGitRepo(ctx context.Context, repo *db.Repo, repoPath string) (*git.Repository, error) {
-	if err := ensureGitRepoExists(ctx, repo, repoPath); err != nil {
-		return nil, err
-	}
-	return git.PlainOpen(repoPath)
-}
-
 func ensureGitRepoExists(ctx context.Context, repo *db.Repo, repoPath string) error {
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(repoPath, 0777); err != nil {
+		if err := os.MkdirAll(repoPath, 0700); err != nil {
 			return errors.Join(fmt.Errorf("failed to create directory %s", repoPath), err)
 		}
 	}
@@ -265,9 +294,10 @@ func ensureGitRepoExists(ctx context.Context, repo *db.Repo, repoPath string) er
 }
 
 func cloneGitRepo(ctx context.Context, repo *db.Repo, repoPath string) error {
-	_, err := git.PlainCloneContext(ctx, repoPath, false, &git.CloneOptions{
-		URL:  repo.Url,
-		Auth: repo.Auth(),
+	_, err := git.PlainCloneContext(ctx, repoPath, true, &git.CloneOptions{
+		URL:    repo.Url,
+		Auth:   repo.Auth(),
+		Mirror: true,
 	})
 	if err != nil {
 		return errors.Join(fmt.Errorf("failed to clone git repository %s into %s", repo.Url, repoPath), err)
@@ -0,0 +1,569 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// GraphCommit is one row of the commit graph.
+type GraphCommit struct {
+	Hash        string    `json:"hash"`
+	Parents     []string  `json:"parents"`
+	Refs        []string  `json:"refs"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	Date        time.Time `json:"date"`
+	Subject     string    `json:"subject"`
+	// Lane is the column of the commit in the graph.
+	Lane int `json:"lane"`
+	// Edges are the lines from this row to the next one.
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphEdge is a line from lane From of a row to lane To of the next row.
+type GraphEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// LogQuery selects a page of the history. Ref limits the graph to the
+// history of a single revision, the other filters are checked per commit.
+type LogQuery struct {
+	Ref     string
+	Author  string
+	Message string
+	Path    string
+	// Since and Until filter by the author date, which is the date the rows show.
+	Since  time.Time
+	Until  time.Time
+	Offset int
+	Limit  int
+}
+
+// LogPage is a page of the history. Next is the offset of the following
+// page and zero on the last page.
+type LogPage struct {
+	Commits []GraphCommit `json:"commits"`
+	Next    int           `json:"next,omitempty"`
+}
+
+const (
+	defaultLogLimit = 100
+	maxLogLimit     = 500
+	// maxLogScan bounds the commits checked against the filters per page,
+	// so that a rare match doesn't block the request. The page may be short then.
+	maxLogScan = 5000
+)
+
+// Filtered reports whether the query drops commits from the graph, in which
+// case the lanes can't be drawn.
+func (q LogQuery) Filtered() bool {
+	return q.Author != "" || q.Message != "" || q.Path != "" || !q.Since.IsZero() || !q.Until.IsZero()
+}
+
+// graphWalk lays out the graph of a set of tips as far as the requested
+// pages reach. Commits are walked newest first by committer date, like git
+// log without --topo-order, so a page doesn't need the whole history. A
+// parent with a newer date than one of its children (clock skew) may come
+// before that child, the line between them is left out then.
+type graphWalk struct {
+	mutex  sync.Mutex
+	refs   map[plumbing.Hash][]string
+	queue  commitHeap
+	queued map[plumbing.Hash]bool
+	rows   []GraphCommit
+	layout laneLayout
+	// done is set when every commit is laid out, including the edges of the last row.
+	done bool
+}
+
+// graphCache keeps the walks of recent ref states, so that following pages
+// continue where the previous page stopped.
+var graphCache = newTTLCache[*graphWalk](10*time.Minute, 8)
+
+// Graph returns a page of the commits reachable from any ref (or only
+// query.Ref), newest first. Only the local state is read, fetching is left
+// to the background fetcher.
+func Graph(ctx context.Context, repo *db.Repo, query LogQuery) (LogPage, error) {
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return LogPage{}, err
+	}
+	defer unlock()
+	if query.Limit <= 0 {
+		query.Limit = defaultLogLimit
+	}
+	query.Limit = min(query.Limit, maxLogLimit)
+	query.Path = strings.Trim(query.Path, "/")
+
+	walk, err := loadGraph(r, repo, query.Ref)
+	if err != nil {
+		return LogPage{}, err
+	}
+
+	page := LogPage{Commits: []GraphCommit{}}
+	if !query.Filtered() {
+		// one more row tells whether there is a next page
+		rows, err := walk.rowsTo(ctx, r, query.Offset+query.Limit+1)
+		if err != nil {
+			return LogPage{}, err
+		}
+		if query.Offset >= len(rows) {
+			return page, nil
+		}
+		end := min(query.Offset+query.Limit, len(rows))
+		page.Commits = rows[query.Offset:end]
+		if end < len(rows) {
+			page.Next = end
+		}
+		return page, nil
+	}
+
+	var rows []GraphCommit
+	for i := query.Offset; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return LogPage{}, err
+		}
+		if i >= len(rows) {
+			if rows, err = walk.rowsTo(ctx, r, i+defaultLogLimit); err != nil {
+				return LogPage{}, err
+			}
+			if i >= len(rows) {
+				break
+			}
+		}
+		if len(page.Commits) == query.Limit || i-query.Offset == maxLogScan {
+			page.Next = i
+			break
+		}
+		c, err := r.CommitObject(plumbing.NewHash(rows[i].Hash))
+		if err != nil {
+			return LogPage{}, fmt.Errorf("load commit %s: %w", rows[i].Hash, err)
+		}
+		ok, err := matchesQuery(r, c, query)
+		if err != nil {
+			return LogPage{}, err
+		}
+		if ok {
+			row := rows[i]
+			row.Lane = 0
+			row.Edges = nil
+			page.Commits = append(page.Commits, row)
+		}
+	}
+	return page, nil
+}
+
+// loadGraph returns the walk of the history reachable from ref, or from all
+// refs if ref is empty. A moved ref starts a new walk.
+func loadGraph(r *git.Repository, repo *db.Repo, ref string) (*graphWalk, error) {
+	refs, err := refNames(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []plumbing.Hash
+	if ref != "" {
+		hash, err := r.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", ref, err)
+		}
+		tips = append(tips, *hash)
+	} else {
+		for hash := range refs {
+			tips = append(tips, hash)
+		}
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].String() < tips[j].String()
+	})
+
+	keyBuilder := strings.Builder{}
+	keyBuilder.WriteString(repo.Name)
+	for _, tip := range tips {
+		keyBuilder.WriteString("/")
+		keyBuilder.WriteString(tip.String())
+	}
+	cacheKey := keyBuilder.String()
+	if cached, ok := graphCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	walk := &graphWalk{
+		refs:   refs,
+		queued: make(map[plumbing.Hash]bool),
+		layout: laneLayout{emitted: make(map[string]bool)},
+	}
+	for _, tip := range tips {
+		c, err := r.CommitObject(tip)
+		if err != nil {
+			// refs of trees or blobs
+			continue
+		}
+		walk.queued[tip] = true
+		heap.Push(&walk.queue, c)
+	}
+	graphCache.set(cacheKey, walk)
+	return walk, nil
+}
+
+// rowsTo walks until n rows are laid out or the history ends and returns
+// the finished rows. Finished rows don't change anymore, so the result can
+// be used without holding the lock.
+func (w *graphWalk) rowsTo(ctx context.Context, r *git.Repository, n int) ([]GraphCommit, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for !w.done && w.finished() < n {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := w.step(r); err != nil {
+			return nil, err
+		}
+	}
+	return w.rows[:min(n, w.finished())], nil
+}
+
+// finished is the number of rows whose edges are known, which needs the
+// row after them.
+func (w *graphWalk) finished() int {
+	if w.done {
+		return len(w.rows)
+	}
+	return max(len(w.rows)-1, 0)
+}
+
+// step lays out the newest commit that hasn't been walked yet.
+func (w *graphWalk) step(r *git.Repository) error {
+	if w.queue.Len() == 0 {
+		w.done = true
+		return nil
+	}
+	c := heap.Pop(&w.queue).(*object.Commit)
+	for _, p := range c.ParentHashes {
+		if w.queued[p] {
+			continue
+		}
+		w.queued[p] = true
+		parent, err := r.CommitObject(p)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// the history of shallow clones ends early
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load commit %s: %w", p, err)
+		}
+		heap.Push(&w.queue, parent)
+	}
+
+	parents := make([]string, len(c.ParentHashes))
+	for j, p := range c.ParentHashes {
+		parents[j] = p.String()
+	}
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	w.rows = append(w.rows, GraphCommit{
+		Hash:        c.Hash.String(),
+		Parents:     parents,
+		Refs:        w.refs[c.Hash],
+		Author:      c.Author.Name,
+		AuthorEmail: c.Author.Email,
+		Date:        c.Author.When,
+		Subject:     subject,
+	})
+	if len(w.rows) > 1 {
+		w.layout.finishEdges(&w.rows[len(w.rows)-2], c.Hash.String())
+	}
+	w.layout.add(&w.rows[len(w.rows)-1])
+	return nil
+}
+
+func matchesQuery(r *git.Repository, c *object.Commit, query LogQuery) (bool, error) {
+	if query.Author != "" &&
+		!containsFold(c.Author.Name, query.Author) &&
+		!containsFold(c.Author.Email, query.Author) {
+		return false, nil
+	}
+	if query.Message != "" && !containsFold(c.Message, query.Message) {
+		return false, nil
+	}
+	if !query.Since.IsZero() && c.Author.When.Before(query.Since) {
+		return false, nil
+	}
+	if !query.Until.IsZero() && !c.Author.When.Before(query.Until) {
+		return false, nil
+	}
+	if query.Path != "" {
+		return touchesPath(r, c, query.Path)
+	}
+	return true, nil
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// touchesPath reports whether the file or directory at p differs from all
+// parents, which is how git log decides if a commit is part of the history of p.
+func touchesPath(r *git.Repository, c *object.Commit, p string) (bool, error) {
+	hash, err := pathHash(c, p)
+	if err != nil {
+		return false, err
+	}
+	if len(c.ParentHashes) == 0 {
+		return hash != plumbing.ZeroHash, nil
+	}
+	for _, parentHash := range c.ParentHashes {
+		parent, err := r.CommitObject(parentHash)
+		if err != nil {
+			return false, fmt.Errorf("load commit %s: %w", parentHash, err)
+		}
+		parentPathHash, err := pathHash(parent, p)
+		if err != nil {
+			return false, err
+		}
+		if parentPathHash == hash {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// pathHash returns the hash of the tree entry at p, or the zero hash if the
+// commit doesn't contain p.
+func pathHash(c *object.Commit, p string) (plumbing.Hash, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("load tree of %s: %w", c.Hash, err)
+	}
+	entry, err := tree.FindEntry(p)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return plumbing.ZeroHash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("find %s in %s: %w", p, c.Hash, err)
+	}
+	return entry.Hash, nil
+}
+
+// refNames returns the short names of the refs pointing to each commit.
+// Annotated tags are resolved to the commit they point to.
+func refNames(r *git.Repository) (map[plumbing.Hash][]string, error) {
+	iter, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("list refs: %w", err)
+	}
+	refs := make(map[plumbing.Hash][]string)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := r.Reference(ref.Name(), true)
+			if err != nil {
+				return nil
+			}
+			ref = plumbing.NewHashReference(ref.Name(), resolved.Hash())
+		}
+		hash := ref.Hash()
+		if tag, err := r.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				// tags of trees or blobs aren't part of the graph
+				return nil
+			}
+			hash = commit.Hash
+		}
+		name := ref.Name().Short()
+		if ref.Name().IsTag() {
+			name = "tag: " + name
+		}
+		refs[hash] = append(refs[hash], name)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list refs: %w", err)
+	}
+	for _, names := range refs {
+		sort.Strings(names)
+	}
+	return refs, nil
+}
+
+// reachableCommits walks the whole history of the tips.
+func reachableCommits(r *git.Repository, tips []plumbing.Hash) (map[plumbing.Hash]*object.Commit, error) {
+	commits := make(map[plumbing.Hash]*object.Commit)
+	// shared by all walks, so that history that is reachable from more than one ref is only walked once
+	seen := make(map[plumbing.Hash]bool)
+	for _, hash := range tips {
+		commit, err := r.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		iter := object.NewCommitPreorderIter(commit, seen, nil)
+		err = iter.ForEach(func(c *object.Commit) error {
+			commits[c.Hash] = c
+			seen[c.Hash] = true
+			return nil
+		})
+		if err != nil && !errors.Is(err, storer.ErrStop) {
+			return nil, fmt.Errorf("walk %s: %w", hash, err)
+		}
+	}
+	return commits, nil
+}
+
+// commitHeap pops the commit with the newest committer date first.
+type commitHeap []*object.Commit
+
+func (h commitHeap) Len() int { return len(h) }
+
+func (h commitHeap) Less(i, j int) bool {
+	if !h[i].Committer.When.Equal(h[j].Committer.When) {
+		return h[i].Committer.When.After(h[j].Committer.When)
+	}
+	return h[i].Hash.String() < h[j].Hash.String()
+}
+
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *commitHeap) Push(x any) { *h = append(*h, x.(*object.Commit)) }
+
+func (h *commitHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// laneLayout puts every commit into a lane and computes the lines between
+// the rows, one row at a time. A lane is reserved for the next expected
+// commit, which is the first parent of the commit above. Merges open lanes
+// for the other parents.
+type laneLayout struct {
+	lanes   []string
+	emitted map[string]bool
+	// the lane of the last row, the lanes of its parents and the lanes that
+	// pass it, which are needed for its edges once the next row is known
+	lane        int
+	parentLanes []int
+	passing     []bool
+}
+
+func (l *laneLayout) add(commit *GraphCommit) {
+	l.emitted[commit.Hash] = true
+	lane := -1
+	for j, expected := range l.lanes {
+		if expected != commit.Hash {
+			continue
+		}
+		if lane < 0 {
+			lane = j
+		} else {
+			// branches that end in this commit
+			l.lanes[j] = ""
+		}
+	}
+	if lane < 0 {
+		lane = freeLane(&l.lanes)
+	}
+	commit.Lane = lane
+
+	// lanes that were already in use before this commit pass through
+	l.passing = make([]bool, len(l.lanes))
+	for j, expected := range l.lanes {
+		l.passing[j] = expected != "" && j != lane
+	}
+
+	l.lanes[lane] = ""
+	l.lane = lane
+	l.parentLanes = make([]int, 0, len(commit.Parents))
+	for k, parent := range commit.Parents {
+		if l.emitted[parent] {
+			// the parent came first because of clock skew
+			continue
+		}
+		parentLane := -1
+		for j, expected := range l.lanes {
+			if expected == parent {
+				parentLane = j
+				break
+			}
+		}
+		if parentLane < 0 {
+			if k == 0 {
+				parentLane = lane
+			} else {
+				parentLane = freeLane(&l.lanes)
+			}
+			l.lanes[parentLane] = parent
+		}
+		l.parentLanes = append(l.parentLanes, parentLane)
+	}
+}
+
+// finishEdges computes the edges of the last added row, given the hash of
+// the row after it.
+func (l *laneLayout) finishEdges(commit *GraphCommit, next string) {
+	nextLane := func(j int) int {
+		if l.lanes[j] != next {
+			return j
+		}
+		// the next commit takes the first lane that expects it
+		for k, expected := range l.lanes {
+			if expected == next {
+				return k
+			}
+		}
+		return j
+	}
+	seen := make(map[GraphEdge]bool)
+	addEdge := func(edge GraphEdge) {
+		if !seen[edge] {
+			seen[edge] = true
+			commit.Edges = append(commit.Edges, edge)
+		}
+	}
+	for j := range l.lanes {
+		if j < len(l.passing) && l.passing[j] && l.lanes[j] != "" {
+			addEdge(GraphEdge{From: j, To: nextLane(j)})
+		}
+	}
+	for _, parentLane := range l.parentLanes {
+		addEdge(GraphEdge{From: l.lane, To: nextLane(parentLane)})
+	}
+}
+
+func freeLane(lanes *[]string) int {
+	for j, expected := range *lanes {
+		if expected == "" {
+			return j
+		}
+	}
+	*lanes = append(*lanes, "")
+	return len(*lanes) - 1
+}
@@ -0,0 +1,192 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// FileVersion is a commit that changed a file.
+type FileVersion struct {
+	Hash plumbing.Hash
+	// Parent is the first parent of the commit, or the zero hash for a root commit.
+	Parent plumbing.Hash
+	// Path is the path of the file in the commit, and OldPath the path in the
+	// parent if the commit renamed the file.
+	Path    string
+	OldPath string
+	Subject string
+	Author  string
+	Date    time.Time
+}
+
+// FileHistoryPage is a page of the versions of a file.
+type FileHistoryPage struct {
+	Versions []FileVersion
+	// Next is the offset of the next page, or zero if this is the last one.
+	// NextPath is the path of the file there, which differs from the
+	// requested path if a rename was followed.
+	Next     int
+	NextPath string
+}
+
+const (
+	fileHistoryLimit = 100
+	// maxFileHistoryScan bounds the commits checked per page, so that the
+	// history of a rarely changed file doesn't walk the whole repo at once.
+	maxFileHistoryScan = 5000
+)
+
+// historyCache keeps recent file history pages, which never change for a commit.
+var historyCache = newTTLCache[FileHistoryPage](10*time.Minute, 32)
+
+// FileHistory returns a page of the commits reachable from rev that changed
+// the file at path, newest first, starting at the commit offset of the
+// history of rev. Like git log --follow, it continues with the old path when
+// a commit added the file as a rename of another one.
+func FileHistory(ctx context.Context, repo *db.Repo, rev, path string, offset, renameThreshold int) (FileHistoryPage, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return FileHistoryPage{}, fmt.Errorf("history %s: %w", rev, err)
+	}
+	path = strings.Trim(path, "/")
+	cacheKey := fmt.Sprintf("%s/%s/%d/%d/%s", repo.Name, hashes[0], offset, renameThreshold, path)
+	if cached, ok := historyCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return FileHistoryPage{}, err
+	}
+	defer unlock()
+
+	walk, err := loadGraph(r, repo, hashes[0].String())
+	if err != nil {
+		return FileHistoryPage{}, err
+	}
+
+	page := FileHistoryPage{Versions: []FileVersion{}}
+	var rows []GraphCommit
+	for i := offset; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return FileHistoryPage{}, err
+		}
+		if i >= len(rows) {
+			if rows, err = walk.rowsTo(ctx, r, i+defaultLogLimit); err != nil {
+				return FileHistoryPage{}, err
+			}
+			if i >= len(rows) {
+				break
+			}
+		}
+		if len(page.Versions) == fileHistoryLimit || i-offset == maxFileHistoryScan {
+			page.Next = i
+			page.NextPath = path
+			break
+		}
+		c, err := r.CommitObject(plumbing.NewHash(rows[i].Hash))
+		if err != nil {
+			return FileHistoryPage{}, fmt.Errorf("load commit %s: %w", rows[i].Hash, err)
+		}
+		changed, err := touchesPath(r, c, path)
+		if err != nil {
+			return FileHistoryPage{}, err
+		}
+		if !changed {
+			continue
+		}
+
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		version := FileVersion{
+			Hash:    c.Hash,
+			Path:    path,
+			Subject: subject,
+			Author:  c.Author.Name,
+			Date:    c.Author.When,
+		}
+		if len(c.ParentHashes) > 0 {
+			version.Parent = c.ParentHashes[0]
+			oldPath, err := renamedFrom(ctx, r, c, path, renameThreshold)
+			if err != nil {
+				return FileHistoryPage{}, err
+			}
+			if oldPath != "" {
+				version.OldPath = oldPath
+				path = oldPath
+			}
+		}
+		page.Versions = append(page.Versions, version)
+	}
+
+	historyCache.set(cacheKey, page)
+	return page, nil
+}
+
+// renamedFrom returns the path the file at p had in the first parent of c, if
+// c added it as a rename. Only deleted files are candidates, so the tree diff
+// is skipped entirely if the file already existed in the parent.
+func renamedFrom(ctx context.Context, r *git.Repository, c *object.Commit, p string, renameThreshold int) (string, error) {
+	parent, err := r.CommitObject(c.ParentHashes[0])
+	if err != nil {
+		return "", fmt.Errorf("load commit %s: %w", c.ParentHashes[0], err)
+	}
+	if hash, err := pathHash(parent, p); err != nil || hash != plumbing.ZeroHash {
+		return "", err
+	}
+
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", fmt.Errorf("load tree of %s: %w", parent.Hash, err)
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return "", fmt.Errorf("load tree of %s: %w", c.Hash, err)
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, nil)
+	if err != nil {
+		return "", fmt.Errorf("diff %s..%s: %w", parent.Hash, c.Hash, err)
+	}
+
+	var candidates object.Changes
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return "", err
+		}
+		if action == merkletrie.Delete || (action == merkletrie.Insert && change.To.Name == p) {
+			candidates = append(candidates, change)
+		}
+	}
+	_, renames, err := detectRenames(ctx, candidates, renameThreshold)
+	if err != nil {
+		return "", fmt.Errorf("detect renames %s..%s: %w", parent.Hash, c.Hash, err)
+	}
+	if rename, ok := renames[p]; ok && !rename.Copy {
+		return rename.From, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,215 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// rwLock is a read/write lock that gives up waiting when the context is
+// done. Waiting writers block new readers, so fetches aren't starved.
+type rwLock struct {
+	mutex          sync.Mutex
+	readers        int
+	writer         bool
+	waitingWriters int
+	// changed is closed and replaced whenever the lock is released
+	changed chan struct{}
+	// users counts the holders and waiters, the lock is dropped at zero
+	users int
+}
+
+func (l *rwLock) lock(ctx context.Context, write bool) error {
+	waiting := false
+	for {
+		l.mutex.Lock()
+		if write && !l.writer && l.readers == 0 {
+			l.writer = true
+			if waiting {
+				l.waitingWriters--
+			}
+			l.mutex.Unlock()
+			return nil
+		}
+		if !write && !l.writer && l.waitingWriters == 0 {
+			l.readers++
+			l.mutex.Unlock()
+			return nil
+		}
+		if write && !waiting {
+			waiting = true
+			l.waitingWriters++
+		}
+		changed := l.changed
+		l.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if waiting {
+				l.mutex.Lock()
+				l.waitingWriters--
+				l.broadcast()
+				l.mutex.Unlock()
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *rwLock) unlock(write bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if write {
+		l.writer = false
+	} else {
+		l.readers--
+	}
+	l.broadcast()
+}
+
+// broadcast wakes all waiters. l.mutex must be held.
+func (l *rwLock) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+var (
+	pathLocks      = make(map[string]*rwLock)
+	pathLocksMutex = &sync.Mutex{}
+)
+
+// lockPath locks the git directory at path for reading or writing and
+// returns the function that releases it.
+func lockPath(ctx context.Context, path string, write bool) (func(), error) {
+	pathLocksMutex.Lock()
+	l, ok := pathLocks[path]
+	if !ok {
+		l = &rwLock{changed: make(chan struct{})}
+		pathLocks[path] = l
+	}
+	l.users++
+	pathLocksMutex.Unlock()
+
+	release := func() {
+		pathLocksMutex.Lock()
+		defer pathLocksMutex.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(pathLocks, path)
+		}
+	}
+	if err := l.lock(ctx, write); err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		l.unlock(write)
+		release()
+	}, nil
+}
+
+// mirrorPath is the bare mirror of the repo, which has all objects and refs
+// but no worktree.
+func mirrorPath(repo *db.Repo) string {
+	return filepath.Join(reposDir, repo.Name, mirrorDirName)
+}
+
+// openRepo opens the git directory at path, cloning the repo first if it
+// doesn't exist. The returned unlock function must be called once the
+// repository isn't used anymore.
+func openRepo(ctx context.Context, repo *db.Repo, path string, write bool) (*git.Repository, func(), error) {
+	if !write && !repoExists(path) {
+		// cloning needs the write lock
+		unlock, err := lockPath(ctx, path, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = ensureGitRepoExists(ctx, repo, path)
+		unlock()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	unlock, err := lockPath(ctx, path, write)
+	if err != nil {
+		return nil, nil, err
+	}
+	if write {
+		if err := ensureGitRepoExists(ctx, repo, path); err != nil {
+			unlock()
+			return nil, nil, err
+		}
+	}
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return r, unlock, nil
+}
+
+func repoExists(path string) bool {
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) > 0
+}
+
+// resolveRevisions resolves revs in the mirror of repo. Revisions that
+// are unknown are fetched, which needs the write lock.
+func resolveRevisions(ctx context.Context, repo *db.Repo, revs ...string) ([]plumbing.Hash, error) {
+	hashes := make([]plumbing.Hash, len(revs))
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return nil, err
+	}
+	missing := false
+	for i, rev := range revs {
+		if hash, err := r.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			hashes[i] = *hash
+		} else {
+			missing = true
+		}
+	}
+	unlock()
+	if !missing {
+		return hashes, nil
+	}
+
+	r, unlock, err = openRepo(ctx, repo, mirrorPath(repo), true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for i, rev := range revs {
+		if !hashes[i].IsZero() {
+			continue
+		}
+		hashes[i], err = ensureRevision(ctx, r, rev, repo.Auth())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,227 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Ref is a branch or tag with its last commit and how far it diverged from
+// the default branch.
+type Ref struct {
+	Name    string    `json:"name"`
+	Tag     bool      `json:"tag"`
+	Default bool      `json:"default"`
+	Hash    string    `json:"hash"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	// Ahead is the number of commits that are not on the default branch.
+	Ahead int `json:"ahead"`
+	// Behind is the number of commits on the default branch that are missing.
+	Behind int `json:"behind"`
+}
+
+// Refs lists the branches and tags of the last fetch. The default
+// branch comes first, followed by the branches and then the tags, each
+// sorted by the date of their last commit.
+func Refs(ctx context.Context, repo *db.Repo) ([]Ref, error) {
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	defaultBranch := ""
+	if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+		defaultBranch = head.Name().Short()
+	}
+	var history *branchHistory
+	if defaultBranch != "" {
+		history, err = loadBranchHistory(r, repo, defaultBranch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	iter, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("list refs: %w", err)
+	}
+	defer iter.Close()
+
+	var refs []Ref
+	for {
+		ref, err := iter.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list refs: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name := ref.Name()
+		if ref.Type() != plumbing.HashReference || !(name.IsBranch() || name.IsTag()) {
+			continue
+		}
+		commit, err := refCommit(r, ref.Hash())
+		if err != nil {
+			// tags of trees or blobs
+			continue
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		info := Ref{
+			Name:    name.Short(),
+			Tag:     name.IsTag(),
+			Default: name.IsBranch() && name.Short() == defaultBranch,
+			Hash:    commit.Hash.String(),
+			Subject: subject,
+			Author:  commit.Author.Name,
+			Date:    commit.Committer.When,
+		}
+		if history != nil {
+			info.Ahead, info.Behind, err = history.aheadBehind(r, commit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		refs = append(refs, info)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Default != refs[j].Default {
+			return refs[i].Default
+		}
+		if refs[i].Tag != refs[j].Tag {
+			return !refs[i].Tag
+		}
+		return refs[i].Date.After(refs[j].Date)
+	})
+	return refs, nil
+}
+
+// refCommit resolves annotated tags to the commit they point to.
+func refCommit(r *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := r.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+	return r.CommitObject(hash)
+}
+
+// branchHistory is the history of a branch as indices, so that many refs can
+// be compared against it without loading the commits again.
+type branchHistory struct {
+	index   map[plumbing.Hash]int
+	parents [][]int
+}
+
+var branchHistoryCache = newTTLCache[*branchHistory](10*time.Minute, 8)
+
+// loadBranchHistory walks the whole history of branch, which is needed to
+// know what is behind it.
+func loadBranchHistory(r *git.Repository, repo *db.Repo, branch string) (*branchHistory, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(branch))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %q: %w", branch, err)
+	}
+	cacheKey := repo.Name + "/" + hash.String()
+	if cached, ok := branchHistoryCache.get(cacheKey); ok {
+		return cached, nil
+	}
+	commits, err := reachableCommits(r, []plumbing.Hash{*hash})
+	if err != nil {
+		return nil, err
+	}
+
+	h := &branchHistory{
+		index:   make(map[plumbing.Hash]int, len(commits)),
+		parents: make([][]int, len(commits)),
+	}
+	for hash := range commits {
+		h.index[hash] = len(h.index)
+	}
+	for hash, c := range commits {
+		i := h.index[hash]
+		for _, p := range c.ParentHashes {
+			if j, ok := h.index[p]; ok {
+				h.parents[i] = append(h.parents[i], j)
+			}
+		}
+	}
+	branchHistoryCache.set(cacheKey, h)
+	return h, nil
+}
+
+// aheadBehind counts the commits only reachable from tip and the commits
+// only reachable from the branch, like git rev-list --left-right --count.
+func (h *branchHistory) aheadBehind(r *git.Repository, tip *object.Commit) (ahead, behind int, err error) {
+	// walk the commits that aren't on the branch until they join it
+	var joined []int
+	seen := map[plumbing.Hash]bool{tip.Hash: true}
+	stack := []*object.Commit{tip}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i, ok := h.index[c.Hash]; ok {
+			joined = append(joined, i)
+			continue
+		}
+		ahead++
+		for _, p := range c.ParentHashes {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			if i, ok := h.index[p]; ok {
+				joined = append(joined, i)
+				continue
+			}
+			parent, err := r.CommitObject(p)
+			if err != nil {
+				return 0, 0, fmt.Errorf("load commit %s: %w", p, err)
+			}
+			stack = append(stack, parent)
+		}
+	}
+
+	reachable := make([]bool, len(h.parents))
+	count := 0
+	for len(joined) > 0 {
+		i := joined[len(joined)-1]
+		joined = joined[:len(joined)-1]
+		if reachable[i] {
+			continue
+		}
+		reachable[i] = true
+		count++
+		joined = append(joined, h.parents[i]...)
+	}
+	return ahead, len(h.parents) - count, nil
+}
@@ -0,0 +1,285 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// DefaultRenameThreshold is the similarity git uses for rename detection.
+const DefaultRenameThreshold = 50
+
+// renameLimit caps the number of candidate pairs that are compared by content,
+// like git's diff.renameLimit. Exact renames are always detected.
+const renameLimit = 1000 * 1000
+
+// Rename describes a file that was moved or copied from another path.
+type Rename struct {
+	From string
+	// Score is the similarity of both versions in percent.
+	Score int
+	Copy  bool
+}
+
+// Renames maps the new path of a file to its source.
+type Renames map[string]Rename
+
+// Get returns the rename of the changed file, if it is one.
+func (r Renames) Get(filePatch diff.FilePatch) (Rename, bool) {
+	_, to := filePatch.Files()
+	if to == nil {
+		return Rename{}, false
+	}
+	rename, ok := r[to.Path()]
+	return rename, ok
+}
+
+type fileContent struct {
+	change *object.Change
+	path   string
+	lines  map[uint64]int
+	size   int
+}
+
+// detectRenames pairs deleted and added files with a similarity of at least
+// threshold percent to renames. Added files that are similar to a modified
+// file are marked as copies of it.
+func detectRenames(ctx context.Context, changes object.Changes, threshold int) (object.Changes, Renames, error) {
+	renames := make(Renames)
+	if threshold <= 0 {
+		return changes, renames, nil
+	}
+
+	var deleted, added, modified []*object.Change
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch action {
+		case merkletrie.Delete:
+			deleted = append(deleted, change)
+		case merkletrie.Insert:
+			added = append(added, change)
+		case merkletrie.Modify:
+			modified = append(modified, change)
+		}
+	}
+	if len(added) == 0 {
+		return changes, renames, nil
+	}
+
+	paired := make(map[*object.Change]*object.Change)
+	var result object.Changes
+
+	// exact renames keep their content, so the blob hashes are equal
+	for _, del := range deleted {
+		for _, add := range added {
+			if paired[add] != nil || del.From.TreeEntry.Hash != add.To.TreeEntry.Hash {
+				continue
+			}
+			paired[add] = del
+			paired[del] = add
+			renames[add.To.Name] = Rename{From: del.From.Name, Score: 100}
+			result = append(result, &object.Change{From: del.From, To: add.To})
+			break
+		}
+	}
+
+	if threshold < 100 && len(deleted)*len(added) <= renameLimit {
+		var sources, targets []*fileContent
+		for _, del := range deleted {
+			if paired[del] == nil {
+				if content, ok := loadFileContent(del, true); ok {
+					sources = append(sources, content)
+				}
+			}
+		}
+		for _, add := range added {
+			if paired[add] == nil {
+				if content, ok := loadFileContent(add, false); ok {
+					targets = append(targets, content)
+				}
+			}
+		}
+
+		for _, pair := range bestPairs(ctx, sources, targets, threshold, false) {
+			del, add := pair.source.change, pair.target.change
+			paired[add] = del
+			paired[del] = add
+			renames[add.To.Name] = Rename{From: del.From.Name, Score: pair.score}
+			result = append(result, &object.Change{From: del.From, To: add.To})
+		}
+
+		// copies are only searched among modified files, like git diff -C
+		if len(modified)*len(added) <= renameLimit {
+			sources = sources[:0]
+			for _, mod := range modified {
+				if content, ok := loadFileContent(mod, true); ok {
+					sources = append(sources, content)
+				}
+			}
+			remaining := targets[:0]
+			for _, target := range targets {
+				if paired[target.change] == nil {
+					remaining = append(remaining, target)
+				}
+			}
+			for _, pair := range bestPairs(ctx, sources, remaining, threshold, true) {
+				mod, add := pair.source.change, pair.target.change
+				paired[add] = mod
+				renames[add.To.Name] = Rename{From: mod.From.Name, Score: pair.score, Copy: true}
+				result = append(result, &object.Change{From: mod.From, To: add.To})
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, change := range changes {
+		if paired[change] == nil {
+			result = append(result, change)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return changePath(result[i]) < changePath(result[j])
+	})
+
+	return result, renames, nil
+}
+
+func changePath(change *object.Change) string {
+	if change.To.Name != "" {
+		return change.To.Name
+	}
+	return change.From.Name
+}
+
+// loadFileContent counts the bytes of every distinct line of the old or new
+// version of a changed text file.
+func loadFileContent(change *object.Change, old bool) (*fileContent, bool) {
+	from, to, err := change.Files()
+	if err != nil {
+		return nil, false
+	}
+	f, name := to, change.To.Name
+	if old {
+		f, name = from, change.From.Name
+	}
+	if f == nil {
+		return nil, false
+	}
+	if binary, err := f.IsBinary(); err != nil || binary {
+		return nil, false
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, false
+	}
+
+	lines := make(map[uint64]int)
+	for len(content) > 0 {
+		line, rest, found := strings.Cut(content, "\n")
+		if found {
+			line += "\n"
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(line))
+		lines[h.Sum64()] += len(line)
+		content = rest
+	}
+	return &fileContent{
+		change: change,
+		path:   name,
+		lines:  lines,
+		size:   int(f.Size),
+	}, true
+}
+
+// similarity is the share of bytes both files have in common lines, relative
+// to the larger file.
+func similarity(a, b *fileContent) int {
+	maxSize := max(a.size, b.size)
+	if maxSize == 0 {
+		return 100
+	}
+	common := 0
+	for h, n := range a.lines {
+		common += min(n, b.lines[h])
+	}
+	return common * 100 / maxSize
+}
+
+type filePair struct {
+	source *fileContent
+	target *fileContent
+	score  int
+}
+
+// bestPairs matches every target with at most one source, preferring the most
+// similar pairs and, for equal scores, pairs with the same file name.
+// Sources are used only once, unless they may be copied to several targets.
+func bestPairs(ctx context.Context, sources, targets []*fileContent, threshold int, reuseSources bool) []filePair {
+	var candidates []filePair
+	for _, source := range sources {
+		for _, target := range targets {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// the similarity can't be higher than the ratio of the file sizes
+			if maxSize := max(source.size, target.size); maxSize > 0 && min(source.size, target.size)*100/maxSize < threshold {
+				continue
+			}
+			if score := similarity(source, target); score >= threshold {
+				candidates = append(candidates, filePair{source, target, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return sameBase(candidates[i]) && !sameBase(candidates[j])
+	})
+
+	usedSources := make(map[*fileContent]bool)
+	usedTargets := make(map[*fileContent]bool)
+	var pairs []filePair
+	for _, candidate := range candidates {
+		if usedSources[candidate.source] || usedTargets[candidate.target] {
+			continue
+		}
+		usedSources[candidate.source] = !reuseSources
+		usedTargets[candidate.target] = true
+		pairs = append(pairs, candidate)
+	}
+	return pairs
+}
+
+func sameBase(pair filePair) bool {
+	return path.Base(pair.source.path) == path.Base(pair.target.path)
+}
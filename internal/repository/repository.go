@@ -17,13 +17,31 @@
 package repository
 
 import (
+	"log"
 	"os"
 	"path/filepath"
+	"viewre/internal/config"
 )
 
-var tempDir string
+// reposDir holds a directory per repo with the bare mirror and the checkouts
+// of single commits for the language servers.
+var reposDir string
+
+const (
+	mirrorDirName = "mirror.git"
+	// legacyCloneDirName is the worktree clone that was used before the mirror.
+	legacyCloneDirName = "HEAD"
+	// checkoutTmpSuffix marks checkouts that are still being written.
+	checkoutTmpSuffix = ".tmp"
+)
 
 func init() {
-	tempDir = filepath.Join(os.TempDir(), "viewre")
-	_ = os.MkdirAll(tempDir, 0777)
+	reposDir = filepath.Join(config.CacheDir, "repos")
+	_ = os.MkdirAll(reposDir, 0700)
+
+	legacyClones, _ := filepath.Glob(filepath.Join(reposDir, "*", legacyCloneDirName))
+	for _, legacyClone := range legacyClones {
+		log.Printf("deleting %s, which was replaced by %s", legacyClone, mirrorDirName)
+		_ = os.RemoveAll(legacyClone)
+	}
 }
@@ -0,0 +1,319 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+type SignatureStatus string
+
+const (
+	SignatureNone       SignatureStatus = "none"
+	SignatureValid      SignatureStatus = "valid"
+	SignatureUnknownKey SignatureStatus = "unknown_key"
+	SignatureInvalid    SignatureStatus = "invalid"
+	// SignatureUnsupported is a signature in a format that can't be verified
+	// here, like the x509 signatures of gpgsm.
+	SignatureUnsupported SignatureStatus = "unsupported"
+	// SignatureKeyError means the signing keys of the repo can't be read, so
+	// no signature can be checked until an admin fixes them.
+	SignatureKeyError SignatureStatus = "key_error"
+)
+
+// Signature is the result of verifying the signature of a commit.
+type Signature struct {
+	Status SignatureStatus
+	// Kind is "gpg", "ssh" or "x509", empty for unsigned commits and
+	// unknown formats.
+	Kind string
+	// Signer names the key of a valid signature, or is the fingerprint of an
+	// unknown SSH key.
+	Signer string
+	// Reason explains why the signature is invalid or the keys can't be read.
+	Reason string
+}
+
+const (
+	pgpKeyBlockStart  = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	pgpKeyBlockEnd    = "-----END PGP PUBLIC KEY BLOCK-----"
+	pgpSignatureStart = "-----BEGIN PGP SIGNATURE-----"
+	pgpMessageStart   = "-----BEGIN PGP MESSAGE-----"
+	sshSignatureStart = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureEnd   = "-----END SSH SIGNATURE-----"
+	// x509SignatureStart starts the signatures of gpg.format=x509.
+	x509SignatureStart = "-----BEGIN SIGNED MESSAGE-----"
+	// sshSigNamespace is the namespace git signs commits in.
+	sshSigNamespace = "git"
+)
+
+// sshSigningKey is a key of an allowed signers line, which is an
+// authorized_keys line that may be prefixed by the principals.
+type sshSigningKey struct {
+	key  ssh.PublicKey
+	name string
+}
+
+// ValidateSigningKeys checks that the signing keys of a repo can be parsed.
+func ValidateSigningKeys(keys string) error {
+	_, _, err := parseSigningKeys(keys)
+	return err
+}
+
+// parseSigningKeys splits the signing keys of a repo into the armored GPG key
+// blocks and the SSH public keys on the remaining lines.
+func parseSigningKeys(keys string) (openpgp.EntityList, []sshSigningKey, error) {
+	var pgpKeys openpgp.EntityList
+	var sshKeys []sshSigningKey
+	for {
+		start := strings.Index(keys, pgpKeyBlockStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(keys[start:], pgpKeyBlockEnd)
+		if end < 0 {
+			return nil, nil, errors.New("unterminated PGP public key block")
+		}
+		end += start + len(pgpKeyBlockEnd)
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(keys[start:end]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("read PGP public key: %w", err)
+		}
+		pgpKeys = append(pgpKeys, entities...)
+		keys = keys[:start] + keys[end:]
+	}
+
+	for line := range strings.Lines(keys) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseSshSigningKey(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read SSH public key %q: %w", line, err)
+		}
+		sshKeys = append(sshKeys, key)
+	}
+	return pgpKeys, sshKeys, nil
+}
+
+func parseSshSigningKey(line string) (sshSigningKey, error) {
+	// ParseAuthorizedKey would take the principals for options, so lines
+	// that don't start with the key are allowed signers lines
+	if fields := strings.Fields(line); len(fields) >= 2 && isSshKey(fields[0], fields[1]) {
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return sshSigningKey{}, err
+		}
+		if comment == "" {
+			comment = ssh.FingerprintSHA256(key)
+		}
+		return sshSigningKey{key: key, name: comment}, nil
+	}
+	principals, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return sshSigningKey{}, errors.New("no public key")
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+	if err != nil {
+		return sshSigningKey{}, err
+	}
+	return sshSigningKey{key: key, name: principals}, nil
+}
+
+func isSshKey(keyType, encoded string) bool {
+	blob, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	key, err := ssh.ParsePublicKey(blob)
+	return err == nil && key.Type() == keyType
+}
+
+// verifySignature checks the signature of c against the signing keys of its repo.
+func verifySignature(c *object.Commit, signingKeys string) Signature {
+	if c.PGPSignature == "" {
+		return Signature{Status: SignatureNone}
+	}
+	kind := signatureKind(c.PGPSignature)
+	if kind != "gpg" && kind != "ssh" {
+		return Signature{Status: SignatureUnsupported, Kind: kind}
+	}
+
+	pgpKeys, sshKeys, err := parseSigningKeys(signingKeys)
+	if err != nil {
+		return Signature{Status: SignatureKeyError, Kind: kind, Reason: err.Error()}
+	}
+	payload, err := signedPayload(c)
+	if err != nil {
+		return Signature{Status: SignatureInvalid, Kind: kind, Reason: err.Error()}
+	}
+
+	if kind == "ssh" {
+		return verifySshSignature(payload, c.PGPSignature, sshKeys)
+	}
+	entity, err := openpgp.CheckArmoredDetachedSignature(pgpKeys, bytes.NewReader(payload), strings.NewReader(c.PGPSignature), nil)
+	switch {
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		return Signature{Status: SignatureUnknownKey, Kind: kind}
+	case err != nil:
+		return Signature{Status: SignatureInvalid, Kind: kind, Reason: err.Error()}
+	}
+	return Signature{Status: SignatureValid, Kind: kind, Signer: pgpSigner(entity)}
+}
+
+// signatureKind tells the format of a signature by its armor header, like
+// git does.
+func signatureKind(armored string) string {
+	switch {
+	case strings.HasPrefix(armored, pgpSignatureStart), strings.HasPrefix(armored, pgpMessageStart):
+		return "gpg"
+	case strings.HasPrefix(armored, sshSignatureStart):
+		return "ssh"
+	case strings.HasPrefix(armored, x509SignatureStart):
+		return "x509"
+	}
+	return ""
+}
+
+// signedPayload is the commit object without the signature header.
+func signedPayload(c *object.Commit) ([]byte, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func pgpSigner(entity *openpgp.Entity) string {
+	names := make([]string, 0, len(entity.Identities))
+	for name := range entity.Identities {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return entity.PrimaryKey.KeyIdString()
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// sshSig is the signature blob of the SSHSIG format from OpenSSH's
+// PROTOCOL.sshsig.
+type sshSig struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is what the key actually signs.
+type sshSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func verifySshSignature(payload []byte, armored string, keys []sshSigningKey) Signature {
+	invalid := func(reason string) Signature {
+		return Signature{Status: SignatureInvalid, Kind: "ssh", Reason: reason}
+	}
+
+	body := strings.TrimSpace(armored)
+	body = strings.TrimPrefix(body, sshSignatureStart)
+	body = strings.TrimSuffix(body, sshSignatureEnd)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return invalid("malformed signature: " + err.Error())
+	}
+	var sig sshSig
+	if err := ssh.Unmarshal(blob, &sig); err != nil {
+		return invalid("malformed signature: " + err.Error())
+	}
+	if string(sig.Magic[:]) != "SSHSIG" || sig.Version != 1 {
+		return invalid("unsupported signature format")
+	}
+	if sig.Namespace != sshSigNamespace {
+		return invalid(fmt.Sprintf("signature namespace is %q instead of %q", sig.Namespace, sshSigNamespace))
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return invalid("unsupported hash algorithm " + sig.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	publicKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return invalid("malformed public key: " + err.Error())
+	}
+	var signer *sshSigningKey
+	for i := range keys {
+		if bytes.Equal(keys[i].key.Marshal(), publicKey.Marshal()) {
+			signer = &keys[i]
+			break
+		}
+	}
+	if signer == nil {
+		return Signature{Status: SignatureUnknownKey, Kind: "ssh", Signer: ssh.FingerprintSHA256(publicKey)}
+	}
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return invalid("malformed signature: " + err.Error())
+	}
+	signed := ssh.Marshal(sshSignedData{
+		Magic:         sig.Magic,
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})
+	if err := publicKey.Verify(signed, &signature); err != nil {
+		return invalid(err.Error())
+	}
+	return Signature{Status: SignatureValid, Kind: "ssh", Signer: signer.name}
+}
@@ -0,0 +1,119 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// The fixtures are commits of a throwaway repo, signed with the SSH key of
+// alice.pub and the GPG key of bob.asc.
+
+func loadTestCommit(t *testing.T, name string) *object.Commit {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "signature", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := &plumbing.MemoryObject{}
+	encoded.SetType(plumbing.CommitObject)
+	if _, err := encoded.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	c := &object.Commit{}
+	if err := c.Decode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readTestKey(t *testing.T, name string) string {
+	t.Helper()
+	key, err := os.ReadFile(filepath.Join("testdata", "signature", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(key)
+}
+
+func TestVerifySignature(t *testing.T) {
+	sshKey := readTestKey(t, "alice.pub")
+	gpgKey := readTestKey(t, "bob.asc")
+	tamper := func(c *object.Commit) {
+		c.Message += "tampered\n"
+	}
+
+	tests := []struct {
+		name   string
+		commit string
+		keys   string
+		change func(c *object.Commit)
+		status SignatureStatus
+		kind   string
+		signer string
+	}{
+		{name: "unsigned", commit: "unsigned.commit", keys: sshKey + gpgKey, status: SignatureNone},
+		{name: "ssh valid", commit: "ssh.commit", keys: sshKey, status: SignatureValid, kind: "ssh", signer: "alice@example.com"},
+		{name: "ssh valid among gpg keys", commit: "ssh.commit", keys: gpgKey + sshKey, status: SignatureValid, kind: "ssh", signer: "alice@example.com"},
+		{name: "ssh principal", commit: "ssh.commit", keys: "alice-principal " + sshKey, status: SignatureValid, kind: "ssh", signer: "alice-principal"},
+		{name: "ssh unknown key", commit: "ssh.commit", keys: gpgKey, status: SignatureUnknownKey, kind: "ssh", signer: "SHA256:W9+jkfmgn82iFnfa4lqWNjW+fMsGNMoEjWlY5Fddvgg"},
+		{name: "ssh tampered", commit: "ssh.commit", keys: sshKey, change: tamper, status: SignatureInvalid, kind: "ssh"},
+		{name: "gpg valid", commit: "gpg.commit", keys: sshKey + gpgKey, status: SignatureValid, kind: "gpg", signer: "Bob <bob@example.com>"},
+		{name: "gpg unknown key", commit: "gpg.commit", keys: sshKey, status: SignatureUnknownKey, kind: "gpg"},
+		{name: "gpg tampered", commit: "gpg.commit", keys: gpgKey, change: tamper, status: SignatureInvalid, kind: "gpg"},
+		{name: "ssh broken keys", commit: "ssh.commit", keys: sshKey + "not a key\n", status: SignatureKeyError, kind: "ssh"},
+		{name: "gpg broken keys", commit: "gpg.commit", keys: "-----BEGIN PGP PUBLIC KEY BLOCK-----\n", status: SignatureKeyError, kind: "gpg"},
+		{
+			name:   "x509",
+			commit: "unsigned.commit",
+			keys:   sshKey + gpgKey,
+			change: func(c *object.Commit) {
+				c.PGPSignature = x509SignatureStart + "\nMIAGCSqGSIb3DQEHAqCAMIACAQExDzANBglghkgBZQMEAgEFADCABgkqhkiG9w0BBwEAAKCA\n-----END SIGNED MESSAGE-----\n"
+			},
+			status: SignatureUnsupported,
+			kind:   "x509",
+		},
+		{
+			name:   "unknown format",
+			commit: "unsigned.commit",
+			change: func(c *object.Commit) {
+				c.PGPSignature = "not a signature\n"
+			},
+			status: SignatureUnsupported,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := loadTestCommit(t, test.commit)
+			if test.change != nil {
+				test.change(c)
+			}
+			got := verifySignature(c, test.keys)
+			if got.Status != test.status || got.Kind != test.kind {
+				t.Fatalf("got %s %q (%s), want %s %q", got.Status, got.Kind, got.Reason, test.status, test.kind)
+			}
+			if got.Signer != test.signer {
+				t.Errorf("got signer %q, want %q", got.Signer, test.signer)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"viewre/internal/db"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+)
+
+// TreeEntry is a file or directory in a directory listing.
+type TreeEntry struct {
+	Name      string
+	Path      string
+	Dir       bool
+	Symlink   bool
+	Submodule bool
+	// Size is only set for files.
+	Size int64
+}
+
+// ErrIsFile is returned by ListTree when the path is a file.
+var ErrIsFile = errors.New("path is a file")
+
+// ListTree lists the directory at dir in the tree of rev, directories first.
+// The empty dir is the root of the tree. The resolved commit hash is
+// returned as well, so that links don't move with branches.
+func ListTree(ctx context.Context, repo *db.Repo, rev, dir string) (plumbing.Hash, []TreeEntry, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return plumbing.ZeroHash, nil, fmt.Errorf("tree %s: %w", rev, err)
+	}
+	hash := hashes[0]
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return hash, nil, err
+	}
+	defer unlock()
+
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return hash, nil, fmt.Errorf("load commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return hash, nil, fmt.Errorf("load tree of %s: %w", hash, err)
+	}
+	if dir != "" {
+		entry, err := tree.FindEntry(dir)
+		if err != nil {
+			return hash, nil, fmt.Errorf("find %s in %s: %w", dir, hash, err)
+		}
+		if entry.Mode != filemode.Dir {
+			return hash, nil, ErrIsFile
+		}
+		tree, err = r.TreeObject(entry.Hash)
+		if err != nil {
+			return hash, nil, fmt.Errorf("load tree %s: %w", dir, err)
+		}
+	}
+
+	entries := make([]TreeEntry, 0, len(tree.Entries))
+	for _, entry := range tree.Entries {
+		treeEntry := TreeEntry{
+			Name:      entry.Name,
+			Path:      entry.Name,
+			Dir:       entry.Mode == filemode.Dir,
+			Symlink:   entry.Mode == filemode.Symlink,
+			Submodule: entry.Mode == filemode.Submodule,
+		}
+		if dir != "" {
+			treeEntry.Path = dir + "/" + entry.Name
+		}
+		if entry.Mode.IsFile() {
+			if size, err := r.Storer.EncodedObjectSize(entry.Hash); err == nil {
+				treeEntry.Size = size
+			}
+		}
+		entries = append(entries, treeEntry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Dir && !entries[j].Dir
+	})
+	return hash, entries, nil
+}
+
+// File is a file in the tree of a commit.
+type File struct {
+	Commit plumbing.Hash
+	Hash   plumbing.Hash
+	Size   int64
+	// Content is nil if the file is larger than the limit passed to ReadFile.
+	Content []byte
+}
+
+// ReadFile reads the file at path in the tree of rev. The content of files
+// larger than maxSize isn't read.
+func ReadFile(ctx context.Context, repo *db.Repo, rev, path string, maxSize int64) (File, error) {
+	hashes, err := resolveRevisions(ctx, repo, rev)
+	if err != nil {
+		return File{}, fmt.Errorf("file %s: %w", rev, err)
+	}
+	file := File{Commit: hashes[0]}
+
+	r, unlock, err := openRepo(ctx, repo, mirrorPath(repo), false)
+	if err != nil {
+		return file, err
+	}
+	defer unlock()
+
+	commit, err := r.CommitObject(file.Commit)
+	if err != nil {
+		return file, fmt.Errorf("load commit %s: %w", file.Commit, err)
+	}
+	f, err := commit.File(path)
+	if err != nil {
+		return file, fmt.Errorf("open %s at %s: %w", path, file.Commit, err)
+	}
+	file.Hash = f.Hash
+	file.Size = f.Size
+	if f.Size > maxSize {
+		return file, nil
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return file, fmt.Errorf("read %s at %s: %w", path, file.Commit, err)
+	}
+	defer reader.Close()
+	file.Content, err = io.ReadAll(reader)
+	if err != nil {
+		return file, fmt.Errorf("read %s at %s: %w", path, file.Commit, err)
+	}
+	return file, nil
+}
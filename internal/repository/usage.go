@@ -0,0 +1,256 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"viewre/internal/config"
+	"viewre/internal/lsp"
+)
+
+// gcInterval is how often the cache is checked against the quota even if
+// nothing was checked out.
+const gcInterval = 10 * time.Minute
+
+// gcTrigger asks the garbage collector to run after a checkout.
+var gcTrigger = make(chan struct{}, 1)
+
+// RepoUsage is the disk space used by a repo in the cache directory.
+type RepoUsage struct {
+	Name          string
+	CloneSize     int64
+	Checkouts     int
+	CheckoutsSize int64
+}
+
+func (u RepoUsage) Size() int64 {
+	return u.CloneSize + u.CheckoutsSize
+}
+
+// cacheFile is a checkout or a highlighted file the garbage collector may delete.
+type cacheFile struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+	checkout bool
+}
+
+// DiskUsage returns the space used by every repo directory and by the whole
+// cache directory, which also contains the highlight cache.
+func DiskUsage() ([]RepoUsage, int64) {
+	entries, _ := os.ReadDir(reposDir)
+	usages := make([]RepoUsage, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		usage := RepoUsage{
+			Name:      entry.Name(),
+			CloneSize: dirSize(filepath.Join(reposDir, entry.Name(), mirrorDirName)),
+		}
+		for _, c := range repoCheckouts(entry.Name()) {
+			usage.Checkouts++
+			usage.CheckoutsSize += c.size
+		}
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Size() > usages[j].Size()
+	})
+	return usages, dirSize(config.CacheDir)
+}
+
+// repoCheckouts lists the checkouts of single commits, which CheckoutCommit
+// puts in <repo>/<first 4 chars>/<rest of the revision>.
+func repoCheckouts(repoName string) []cacheFile {
+	var checkouts []cacheFile
+	prefixes, _ := os.ReadDir(filepath.Join(reposDir, repoName))
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || prefix.Name() == mirrorDirName {
+			continue
+		}
+		prefixPath := filepath.Join(reposDir, repoName, prefix.Name())
+		rests, _ := os.ReadDir(prefixPath)
+		for _, rest := range rests {
+			if !rest.IsDir() || strings.HasSuffix(rest.Name(), checkoutTmpSuffix) {
+				continue
+			}
+			info, err := rest.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(prefixPath, rest.Name())
+			checkouts = append(checkouts, cacheFile{
+				path:     path,
+				size:     dirSize(path),
+				lastUsed: info.ModTime(),
+				checkout: true,
+			})
+		}
+	}
+	return checkouts
+}
+
+// highlightFiles lists the files of the highlight cache, including those of
+// old cache versions, which are never used again.
+func highlightFiles() []cacheFile {
+	var files []cacheFile
+	_ = filepath.WalkDir(config.HighlightCacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, cacheFile{
+				path:     path,
+				size:     info.Size(),
+				lastUsed: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	return files
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// StartGarbageCollector keeps the cache directory below config.CacheQuota
+// until ctx is done.
+func StartGarbageCollector(ctx context.Context) {
+	if config.CacheQuota <= 0 {
+		return
+	}
+	for {
+		collectGarbage(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-gcTrigger:
+		case <-time.After(gcInterval):
+		}
+	}
+}
+
+// triggerGarbageCollection runs the garbage collector soon, without waiting for it.
+func triggerGarbageCollection() {
+	select {
+	case gcTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// collectGarbage deletes the least recently used checkouts and highlighted
+// files until the cache directory fits the quota. Checkouts of running
+// language servers and checkouts that are in use are kept.
+func collectGarbage(ctx context.Context) {
+	total := dirSize(config.CacheDir)
+	if total <= config.CacheQuota {
+		return
+	}
+
+	entries := highlightFiles()
+	repoDirs, _ := os.ReadDir(reposDir)
+	for _, repoDir := range repoDirs {
+		if repoDir.IsDir() {
+			entries = append(entries, repoCheckouts(repoDir.Name())...)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	// a canceled context makes lockPath give up instead of waiting
+	tryCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	for _, entry := range entries {
+		if total <= config.CacheQuota || ctx.Err() != nil {
+			break
+		}
+		if entry.checkout {
+			if !removeCheckout(tryCtx, entry.path) {
+				continue
+			}
+		} else if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to delete highlighted file %s: %v", entry.path, err)
+			continue
+		}
+		// drop the prefix directory if this was its last entry
+		_ = os.Remove(filepath.Dir(entry.path))
+		total -= entry.size
+	}
+	if total > config.CacheQuota {
+		log.Printf("cache directory %s uses %d bytes, which is more than the quota of %d bytes", config.CacheDir, total, config.CacheQuota)
+	}
+}
+
+// removeCheckout deletes a checkout unless a language server runs in it or
+// it is locked.
+func removeCheckout(tryCtx context.Context, path string) bool {
+	if lsp.InUse(path) {
+		return false
+	}
+	unlock, err := lockPath(tryCtx, path, true)
+	if err != nil {
+		return false
+	}
+	defer unlock()
+	if err := os.RemoveAll(path); err != nil {
+		log.Printf("failed to delete checkout %s: %v", path, err)
+		return false
+	}
+	return true
+}
+
+// RemoveRepo stops the language servers running in checkouts of a repo and
+// deletes the mirror and all checkouts.
+func RemoveRepo(ctx context.Context, name string) error {
+	repoDir := filepath.Join(reposDir, name)
+	if filepath.Dir(repoDir) != reposDir {
+		return fmt.Errorf("invalid repo name %q", name)
+	}
+	lsp.StopIn(repoDir)
+	unlock, err := lockPath(ctx, filepath.Join(repoDir, mirrorDirName), true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.RemoveAll(repoDir); err != nil {
+		return fmt.Errorf("delete %s: %w", repoDir, err)
+	}
+	return nil
+}
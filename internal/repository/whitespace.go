@@ -0,0 +1,294 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package repository
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// WhitespaceChunk is a chunk whose old and new lines only differ in ignored
+// whitespace. It counts as equal, but its old content may differ from
+// Content, so use ChunkContent to read both sides.
+type WhitespaceChunk struct {
+	From string
+	To   string
+}
+
+func (c WhitespaceChunk) Content() string {
+	return c.To
+}
+
+func (c WhitespaceChunk) Type() diff.Operation {
+	return diff.Equal
+}
+
+// ChunkContent returns the old and new content of a chunk.
+func ChunkContent(chunk diff.Chunk) (from string, to string) {
+	if ws, ok := chunk.(WhitespaceChunk); ok {
+		return ws.From, ws.To
+	}
+	switch chunk.Type() {
+	case diff.Add:
+		return "", chunk.Content()
+	case diff.Delete:
+		return chunk.Content(), ""
+	default:
+		return chunk.Content(), chunk.Content()
+	}
+}
+
+// WhitespaceOnly reports whether all changes of the file are ignored whitespace.
+func WhitespaceOnly(filePatch diff.FilePatch) bool {
+	found := false
+	for _, chunk := range filePatch.Chunks() {
+		if _, ok := chunk.(WhitespaceChunk); ok {
+			found = true
+		} else if chunk.Type() != diff.Equal {
+			return false
+		}
+	}
+	return found
+}
+
+type whitespacePatch struct {
+	diff.Patch
+	filePatches []diff.FilePatch
+}
+
+func (p whitespacePatch) FilePatches() []diff.FilePatch {
+	return p.filePatches
+}
+
+type whitespaceFilePatch struct {
+	diff.FilePatch
+	chunks []diff.Chunk
+}
+
+func (p whitespaceFilePatch) Chunks() []diff.Chunk {
+	return p.chunks
+}
+
+type lineChunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c lineChunk) Content() string {
+	return c.content
+}
+
+func (c lineChunk) Type() diff.Operation {
+	return c.op
+}
+
+func (o DiffOptions) ignoresWhitespace() bool {
+	return o.IgnoreAllSpace || o.IgnoreSpaceChange || o.IgnoreBlankLines
+}
+
+// ignoreWhitespace diffs all text files of the patch again, comparing lines
+// without the whitespace the options ignore.
+func ignoreWhitespace(patch diff.Patch, options DiffOptions) diff.Patch {
+	if !options.ignoresWhitespace() {
+		return patch
+	}
+	filePatches := patch.FilePatches()
+	result := make([]diff.FilePatch, len(filePatches))
+	for i, filePatch := range filePatches {
+		if filePatch.IsBinary() || len(filePatch.Chunks()) == 0 {
+			result[i] = filePatch
+			continue
+		}
+		from, to := FileContent(filePatch)
+		chunks, ok := diffLines(string(from), string(to), options)
+		if !ok {
+			// keep the plain line diff of files that take too long to diff again
+			result[i] = filePatch
+			continue
+		}
+		result[i] = whitespaceFilePatch{
+			FilePatch: filePatch,
+			chunks:    chunks,
+		}
+	}
+	return whitespacePatch{Patch: patch, filePatches: result}
+}
+
+// normalizeLine returns the key two lines are compared by.
+func normalizeLine(line string, options DiffOptions) string {
+	line = strings.TrimSuffix(line, "\n")
+	switch {
+	case options.IgnoreAllSpace:
+		return strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	case options.IgnoreSpaceChange:
+		// like git -b, runs of whitespace are equal and whitespace at the end of the line is ignored
+		keyBuilder := strings.Builder{}
+		space := false
+		for _, r := range line {
+			if unicode.IsSpace(r) {
+				space = true
+				continue
+			}
+			if space {
+				keyBuilder.WriteByte(' ')
+				space = false
+			}
+			keyBuilder.WriteRune(r)
+		}
+		return keyBuilder.String()
+	default:
+		return line
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// whitespaceDiffTimeout bounds the time diffLines spends on one file.
+const whitespaceDiffTimeout = time.Second
+
+// diffLines is a line diff like the one of go-git, but compares normalized lines.
+// It reports false if the diff timed out, as the result isn't minimal then.
+func diffLines(from, to string, options DiffOptions) ([]diff.Chunk, bool) {
+	fromLines := splitLines(from)
+	toLines := splitLines(to)
+
+	// every distinct normalized line is encoded as one rune
+	keys := make(map[string]rune)
+	encode := func(lines []string) []rune {
+		runes := make([]rune, len(lines))
+		for i, line := range lines {
+			key := normalizeLine(line, options)
+			r, ok := keys[key]
+			if !ok {
+				r = rune(len(keys) + 1)
+				if r >= 0xD800 {
+					// skip the surrogate range, which isn't valid in strings
+					r += 0x800
+				}
+				keys[key] = r
+			}
+			runes[i] = r
+		}
+		return runes
+	}
+	fromRunes := encode(fromLines)
+	toRunes := encode(toLines)
+
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = whitespaceDiffTimeout
+	start := time.Now()
+	diffs := dmp.DiffMainRunes(fromRunes, toRunes, false)
+	if time.Since(start) >= whitespaceDiffTimeout {
+		return nil, false
+	}
+
+	var chunks []diff.Chunk
+	add := func(chunk diff.Chunk) {
+		if len(chunks) > 0 {
+			last := chunks[len(chunks)-1]
+			switch prev := last.(type) {
+			case WhitespaceChunk:
+				if ws, ok := chunk.(WhitespaceChunk); ok {
+					chunks[len(chunks)-1] = WhitespaceChunk{From: prev.From + ws.From, To: prev.To + ws.To}
+					return
+				}
+			case lineChunk:
+				if lc, ok := chunk.(lineChunk); ok && lc.op == prev.op {
+					chunks[len(chunks)-1] = lineChunk{content: prev.content + lc.content, op: prev.op}
+					return
+				}
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	i, j := 0, 0
+	for _, d := range diffs {
+		n := len([]rune(d.Text))
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			for k := 0; k < n; k++ {
+				if fromLines[i] == toLines[j] {
+					add(lineChunk{content: toLines[j], op: diff.Equal})
+				} else {
+					add(WhitespaceChunk{From: fromLines[i], To: toLines[j]})
+				}
+				i++
+				j++
+			}
+		case diffmatchpatch.DiffDelete:
+			add(lineChunk{content: strings.Join(fromLines[i:i+n], ""), op: diff.Delete})
+			i += n
+		case diffmatchpatch.DiffInsert:
+			add(lineChunk{content: strings.Join(toLines[j:j+n], ""), op: diff.Add})
+			j += n
+		}
+	}
+
+	if options.IgnoreBlankLines {
+		chunks = ignoreBlankLines(chunks)
+	}
+	return chunks, true
+}
+
+// ignoreBlankLines turns runs of added and deleted chunks that only consist
+// of blank lines into whitespace chunks, like git --ignore-blank-lines.
+func ignoreBlankLines(chunks []diff.Chunk) []diff.Chunk {
+	var result []diff.Chunk
+	for i := 0; i < len(chunks); {
+		if chunks[i].Type() == diff.Equal {
+			result = append(result, chunks[i])
+			i++
+			continue
+		}
+		start := i
+		blank := true
+		ws := WhitespaceChunk{}
+		for ; i < len(chunks) && chunks[i].Type() != diff.Equal; i++ {
+			if strings.TrimSpace(chunks[i].Content()) != "" {
+				blank = false
+			}
+			from, to := ChunkContent(chunks[i])
+			ws.From += from
+			ws.To += to
+		}
+		if blank {
+			result = append(result, ws)
+		} else {
+			result = append(result, chunks[start:i]...)
+		}
+	}
+	return result
+}
@@ -0,0 +1,191 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package theme
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tokens are the highlight names a theme can assign a color to.
+// Capture names from highlights.scm queries are resolved to one of these.
+var Tokens = []string{
+	"attribute",
+	"boolean",
+	"comment",
+	"constant",
+	"constant.builtin",
+	"constructor",
+	"embedded",
+	"function",
+	"function.builtin",
+	"function.macro",
+	"function.method",
+	"keyword",
+	"label",
+	"module",
+	"number",
+	"operator",
+	"property",
+	"punctuation",
+	"punctuation.bracket",
+	"punctuation.delimiter",
+	"punctuation.special",
+	"string",
+	"string.escape",
+	"string.special",
+	"tag",
+	"text.emphasis",
+	"text.literal",
+	"text.reference",
+	"text.strong",
+	"text.title",
+	"text.uri",
+	"type",
+	"type.builtin",
+	"variable",
+	"variable.builtin",
+	"variable.parameter",
+}
+
+// RainbowSize is the number of colors every theme provides for bracket pairs.
+const RainbowSize = 10
+
+// tokenAliases maps capture names used by some grammars to the name used by the others.
+var tokenAliases = map[string]string{
+	"escape":      "string.escape",
+	"field":       "property",
+	"method":      "function.method",
+	"parameter":   "variable.parameter",
+	"namespace":   "module",
+	"conditional": "keyword",
+	"repeat":      "keyword",
+	"include":     "keyword",
+	"preproc":     "keyword",
+	"delimiter":   "punctuation.delimiter",
+	"character":   "string",
+	"charset":     "keyword",
+	"import":      "keyword",
+	"keyframes":   "keyword",
+	"media":       "keyword",
+	"supports":    "keyword",
+}
+
+// Token resolves a capture name like "function.method.builtin" to the most
+// specific known token. Unknown captures like "none" return false.
+func Token(capture string) (string, bool) {
+	for name := capture; name != ""; {
+		if alias, ok := tokenAliases[name]; ok {
+			name = alias
+		}
+		for _, token := range Tokens {
+			if token == name {
+				return token, true
+			}
+		}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		} else {
+			break
+		}
+	}
+	return "", false
+}
+
+// Class returns the CSS class used for a token.
+func Class(token string) string {
+	return "hl-" + strings.ReplaceAll(token, ".", "-")
+}
+
+// RainbowClass returns the CSS class for a bracket at the given nesting depth.
+func RainbowClass(depth int) string {
+	return fmt.Sprintf("hl-rainbow-%d", ((depth%RainbowSize)+RainbowSize)%RainbowSize)
+}
+
+type Theme struct {
+	ID    string
+	Name  string
+	Light bool
+
+	Background       string
+	Foreground       string
+	AddBackground    string
+	AddOutline       string
+	DeleteBackground string
+	DeleteOutline    string
+	SpaceBackground  string
+	SpaceOutline     string
+
+	Colors  map[string]string
+	Rainbow [RainbowSize]string
+}
+
+// Color returns the color for a token, falling back to its parent tokens
+// and finally to the foreground color.
+func (t *Theme) Color(token string) string {
+	for name := token; name != ""; {
+		if color, ok := t.Colors[name]; ok {
+			return color
+		}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		} else {
+			break
+		}
+	}
+	return t.Foreground
+}
+
+// CSS renders the style rules for all tokens of the theme.
+func (t *Theme) CSS() string {
+	cssBuilder := strings.Builder{}
+	cssBuilder.WriteString(":root{")
+	fmt.Fprintf(&cssBuilder, "--code-bg:%s;--code-fg:%s;", t.Background, t.Foreground)
+	fmt.Fprintf(&cssBuilder, "--code-add-bg:%s;--code-add-outline:%s;", t.AddBackground, t.AddOutline)
+	fmt.Fprintf(&cssBuilder, "--code-delete-bg:%s;--code-delete-outline:%s;", t.DeleteBackground, t.DeleteOutline)
+	fmt.Fprintf(&cssBuilder, "--code-space-bg:%s;--code-space-outline:%s;", t.SpaceBackground, t.SpaceOutline)
+	cssBuilder.WriteString("}")
+	if t.Light {
+		cssBuilder.WriteString(".diff{color-scheme:light}")
+	}
+	for _, token := range Tokens {
+		fmt.Fprintf(&cssBuilder, ".%s{color:%s}", Class(token), t.Color(token))
+	}
+	for i, color := range t.Rainbow {
+		fmt.Fprintf(&cssBuilder, ".%s{color:%s}", RainbowClass(i), color)
+	}
+	return cssBuilder.String()
+}
+
+// Get returns the theme with the given ID or the default theme.
+func Get(id string) *Theme {
+	for _, t := range Themes {
+		if t.ID == id {
+			return t
+		}
+	}
+	return Themes[0]
+}
+
+func Exists(id string) bool {
+	for _, t := range Themes {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
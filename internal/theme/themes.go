@@ -0,0 +1,164 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package theme
+
+// Themes lists all shipped themes. The first one is the default.
+var Themes = []*Theme{
+	{
+		ID:               "dark",
+		Name:             "ViewRe Dark",
+		Background:       "#1c1917",
+		Foreground:       "#ffffff",
+		AddBackground:    "#052e16",
+		AddOutline:       "#14532d",
+		DeleteBackground: "#450a0a",
+		DeleteOutline:    "#7f1d1d",
+		SpaceBackground:  "#292524",
+		SpaceOutline:     "#44403c",
+		Colors: map[string]string{
+			"attribute":             "#60a5fa",
+			"comment":               "#a3a3a3",
+			"constant":              "#fbbf24",
+			"constructor":           "#facc15",
+			"function":              "#7dd3fc",
+			"function.builtin":      "#c084fc",
+			"function.macro":        "#fb7185",
+			"keyword":               "#818cf8",
+			"label":                 "#f472b6",
+			"module":                "#facc15",
+			"number":                "#fbbf24",
+			"boolean":               "#fbbf24",
+			"operator":              "#22d3ee",
+			"property":              "#60a5fa",
+			"punctuation":           "#9ca3af",
+			"punctuation.delimiter": "#9ca3af",
+			"punctuation.special":   "#fca5a5",
+			"string":                "#4ade80",
+			"string.escape":         "#a3e635",
+			"string.special":        "#34d399",
+			"tag":                   "#f87171",
+			"text.literal":          "#4ade80",
+			"text.reference":        "#60a5fa",
+			"text.title":            "#818cf8",
+			"text.uri":              "#60a5fa",
+			"type":                  "#facc15",
+			"type.builtin":          "#fbbf24",
+			"variable":              "#ffffff",
+			"variable.builtin":      "#c084fc",
+			"variable.parameter":    "#e7e5e4",
+		},
+		Rainbow: [RainbowSize]string{
+			"#fde047", "#86efac", "#67e8f9", "#c4b5fd", "#fdba74",
+			"#bef264", "#93c5fd", "#fca5a5", "#5eead4", "#f0abfc",
+		},
+	},
+	{
+		ID:               "light",
+		Name:             "ViewRe Light",
+		Light:            true,
+		Background:       "#fafaf9",
+		Foreground:       "#1c1917",
+		AddBackground:    "#dcfce7",
+		AddOutline:       "#86efac",
+		DeleteBackground: "#fee2e2",
+		DeleteOutline:    "#fca5a5",
+		SpaceBackground:  "#e7e5e4",
+		SpaceOutline:     "#d6d3d1",
+		Colors: map[string]string{
+			"attribute":           "#1d4ed8",
+			"comment":             "#737373",
+			"constant":            "#b45309",
+			"constructor":         "#a16207",
+			"function":            "#0369a1",
+			"function.builtin":    "#7e22ce",
+			"function.macro":      "#be123c",
+			"keyword":             "#4338ca",
+			"label":               "#be185d",
+			"module":              "#a16207",
+			"number":              "#b45309",
+			"boolean":             "#b45309",
+			"operator":            "#0e7490",
+			"property":            "#1d4ed8",
+			"punctuation":         "#57534e",
+			"punctuation.special": "#b91c1c",
+			"string":              "#15803d",
+			"string.escape":       "#4d7c0f",
+			"string.special":      "#047857",
+			"tag":                 "#b91c1c",
+			"text.literal":        "#15803d",
+			"text.reference":      "#1d4ed8",
+			"text.title":          "#4338ca",
+			"text.uri":            "#1d4ed8",
+			"type":                "#a16207",
+			"type.builtin":        "#b45309",
+			"variable":            "#1c1917",
+			"variable.builtin":    "#7e22ce",
+			"variable.parameter":  "#44403c",
+		},
+		Rainbow: [RainbowSize]string{
+			"#a16207", "#15803d", "#0e7490", "#6d28d9", "#c2410c",
+			"#4d7c0f", "#1d4ed8", "#b91c1c", "#0f766e", "#a21caf",
+		},
+	},
+	{
+		ID:               "gruvbox",
+		Name:             "Gruvbox Dark",
+		Background:       "#282828",
+		Foreground:       "#ebdbb2",
+		AddBackground:    "#32361a",
+		AddOutline:       "#5b5e1d",
+		DeleteBackground: "#3c1f1e",
+		DeleteOutline:    "#7c2f2c",
+		SpaceBackground:  "#32302f",
+		SpaceOutline:     "#504945",
+		Colors: map[string]string{
+			"attribute":           "#8ec07c",
+			"comment":             "#928374",
+			"constant":            "#d3869b",
+			"constructor":         "#fabd2f",
+			"function":            "#b8bb26",
+			"function.builtin":    "#fe8019",
+			"function.macro":      "#8ec07c",
+			"keyword":             "#fb4934",
+			"label":               "#83a598",
+			"module":              "#fabd2f",
+			"number":              "#d3869b",
+			"boolean":             "#d3869b",
+			"operator":            "#fe8019",
+			"property":            "#83a598",
+			"punctuation":         "#a89984",
+			"punctuation.special": "#fe8019",
+			"string":              "#b8bb26",
+			"string.escape":       "#fe8019",
+			"string.special":      "#8ec07c",
+			"tag":                 "#fb4934",
+			"text.literal":        "#b8bb26",
+			"text.reference":      "#83a598",
+			"text.title":          "#fabd2f",
+			"text.uri":            "#83a598",
+			"type":                "#fabd2f",
+			"type.builtin":        "#fabd2f",
+			"variable":            "#ebdbb2",
+			"variable.builtin":    "#d3869b",
+			"variable.parameter":  "#ebdbb2",
+		},
+		Rainbow: [RainbowSize]string{
+			"#fabd2f", "#b8bb26", "#8ec07c", "#83a598", "#d3869b",
+			"#fe8019", "#fb4934", "#d5c4a1", "#689d6a", "#458588",
+		},
+	},
+}
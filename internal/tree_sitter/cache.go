@@ -0,0 +1,327 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"viewre/internal/config"
+	"viewre/internal/repository"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+// highlightedFile is everything Patch and ChangedSymbols need from the
+// tree of a file, so that a blob is parsed only once.
+type highlightedFile struct {
+	segments []highlightedSegment
+	markers  map[uint]string
+	defs     []definition
+	folds    []fold
+}
+
+func newHighlightedFile(tree *tree_sitter.Tree, code []byte, lang string) *highlightedFile {
+	defs := treeDefinitions(tree, code, lang)
+	markers := scopeMarkers(code, defs)
+	return &highlightedFile{
+		segments: splitSegments(renderWithHighlighting(code, collectSpans(tree, code, lang)), markers),
+		markers:  markers,
+		defs:     defs,
+		folds:    collectFolds(tree, code, defs),
+	}
+}
+
+// highlightCacheVersion is part of the cache directory and must be increased
+// when the queries or the rendering change, so that old entries are ignored.
+const highlightCacheVersion = 2
+
+const highlightCacheSize = 512
+
+var (
+	highlightCacheDir   = filepath.Join(config.HighlightCacheDir, strconv.Itoa(highlightCacheVersion))
+	highlightCache      = make(map[string]*list.Element)
+	highlightCacheOrder = list.New()
+	highlightCacheMutex = &sync.Mutex{}
+)
+
+type highlightCacheEntry struct {
+	key  string
+	file *highlightedFile
+}
+
+// loadHighlightedFile returns the highlighted file from the memory or disk
+// cache. Otherwise the file is parsed, reusing oldTree if it is set, and the
+// tree is returned as well so it can be reused for the other side of a diff.
+// Blobs with the zero hash, like the missing side of an added file, are never cached.
+func loadHighlightedFile(hash plumbing.Hash, code []byte, lang string, oldTree *tree_sitter.Tree) (*highlightedFile, *tree_sitter.Tree) {
+	key := hash.String() + "-" + lang
+	if !hash.IsZero() {
+		if file, ok := getHighlightCache(key, code); ok {
+			return file, nil
+		}
+	}
+
+	tree, err := parse(code, lang, oldTree)
+	if err != nil {
+		tree = nil
+	}
+	file := newHighlightedFile(tree, code, lang)
+	if !hash.IsZero() {
+		setHighlightCache(key, file)
+	}
+	return file, tree
+}
+
+func getHighlightCache(key string, code []byte) (*highlightedFile, bool) {
+	highlightCacheMutex.Lock()
+	if element, ok := highlightCache[key]; ok {
+		highlightCacheOrder.MoveToFront(element)
+		highlightCacheMutex.Unlock()
+		return element.Value.(*highlightCacheEntry).file, true
+	}
+	highlightCacheMutex.Unlock()
+
+	file, ok := readHighlightCache(key, code)
+	if !ok {
+		return nil, false
+	}
+	addHighlightCache(key, file)
+	return file, true
+}
+
+func setHighlightCache(key string, file *highlightedFile) {
+	addHighlightCache(key, file)
+	writeHighlightCache(key, file)
+}
+
+func addHighlightCache(key string, file *highlightedFile) {
+	highlightCacheMutex.Lock()
+	defer highlightCacheMutex.Unlock()
+	if element, ok := highlightCache[key]; ok {
+		highlightCacheOrder.MoveToFront(element)
+		return
+	}
+	highlightCache[key] = highlightCacheOrder.PushFront(&highlightCacheEntry{key: key, file: file})
+	for highlightCacheOrder.Len() > highlightCacheSize {
+		oldest := highlightCacheOrder.Back()
+		highlightCacheOrder.Remove(oldest)
+		delete(highlightCache, oldest.Value.(*highlightCacheEntry).key)
+	}
+}
+
+// storedHighlightedFile is the gob encoding of a highlightedFile.
+// The text of the segments isn't stored, it is taken from the blob.
+type storedHighlightedFile struct {
+	Segments    []storedSegment
+	Markers     map[uint]string
+	Definitions []storedDefinition
+	Folds       []storedFold
+}
+
+type storedSegment struct {
+	Class       string
+	Start       uint
+	End         uint
+	Kind        string
+	Grammarname string
+}
+
+type storedDefinition struct {
+	Kind   string
+	Label  string
+	Name   string
+	Start  uint
+	End    uint
+	Parent int
+}
+
+type storedFold struct {
+	ToggleRow uint
+	StartRow  uint
+	EndRow    uint
+	Key       string
+}
+
+func highlightCachePath(key string) string {
+	return filepath.Join(highlightCacheDir, key[:2], key+".gob")
+}
+
+func readHighlightCache(key string, code []byte) (*highlightedFile, bool) {
+	p := highlightCachePath(key)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	// the modification time tells the garbage collector when the file was used last
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	var stored storedHighlightedFile
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&stored); err != nil {
+		log.Printf("failed to decode highlight cache %s: %v", key, err)
+		return nil, false
+	}
+
+	file := &highlightedFile{
+		segments: make([]highlightedSegment, len(stored.Segments)),
+		markers:  stored.Markers,
+		defs:     make([]definition, len(stored.Definitions)),
+		folds:    make([]fold, len(stored.Folds)),
+	}
+	for i, s := range stored.Segments {
+		if s.Start > s.End || s.End > uint(len(code)) {
+			return nil, false
+		}
+		file.segments[i] = highlightedSegment{
+			class:       s.Class,
+			start:       s.Start,
+			end:         s.End,
+			kind:        s.Kind,
+			grammarname: s.Grammarname,
+		}
+	}
+	for i, d := range stored.Definitions {
+		file.defs[i] = definition{
+			kind:   d.Kind,
+			label:  d.Label,
+			name:   d.Name,
+			start:  d.Start,
+			end:    d.End,
+			parent: d.Parent,
+		}
+	}
+	for i, f := range stored.Folds {
+		file.folds[i] = fold{
+			toggleRow: f.ToggleRow,
+			startRow:  f.StartRow,
+			endRow:    f.EndRow,
+			key:       f.Key,
+		}
+	}
+	return file, true
+}
+
+func writeHighlightCache(key string, file *highlightedFile) {
+	stored := storedHighlightedFile{
+		Segments:    make([]storedSegment, len(file.segments)),
+		Markers:     file.markers,
+		Definitions: make([]storedDefinition, len(file.defs)),
+		Folds:       make([]storedFold, len(file.folds)),
+	}
+	for i, s := range file.segments {
+		stored.Segments[i] = storedSegment{
+			Class:       s.class,
+			Start:       s.start,
+			End:         s.end,
+			Kind:        s.kind,
+			Grammarname: s.grammarname,
+		}
+	}
+	for i, d := range file.defs {
+		stored.Definitions[i] = storedDefinition{
+			Kind:   d.kind,
+			Label:  d.label,
+			Name:   d.name,
+			Start:  d.start,
+			End:    d.end,
+			Parent: d.parent,
+		}
+	}
+	for i, f := range file.folds {
+		stored.Folds[i] = storedFold{
+			ToggleRow: f.toggleRow,
+			StartRow:  f.startRow,
+			EndRow:    f.endRow,
+			Key:       f.key,
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(stored); err != nil {
+		log.Printf("failed to encode highlight cache %s: %v", key, err)
+		return
+	}
+	p := highlightCachePath(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		log.Printf("failed to create highlight cache dir: %v", err)
+		return
+	}
+	// write to a temporary file first, so that readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(p), key+".*.tmp")
+	if err != nil {
+		log.Printf("failed to write highlight cache %s: %v", key, err)
+		return
+	}
+	_, writeErr := tmp.Write(buf.Bytes())
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil {
+		_ = os.Remove(tmp.Name())
+		log.Printf("failed to write highlight cache %s: %v", key, errors.Join(writeErr, closeErr))
+		return
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		_ = os.Remove(tmp.Name())
+		log.Printf("failed to write highlight cache %s: %v", key, err)
+	}
+}
+
+// editTree applies the changes of a file patch to the tree of the old version,
+// so that the new version can be parsed incrementally.
+func editTree(tree *tree_sitter.Tree, chunks []diff.Chunk) {
+	pos := uint(0)
+	point := tree_sitter.Point{}
+	for _, chunk := range chunks {
+		from, to := repository.ChunkContent(chunk)
+		if from == to {
+			pos += uint(len(to))
+			point = advancePoint(point, to)
+			continue
+		}
+		// positions are in the document as far as it has been edited
+		tree.Edit(&tree_sitter.InputEdit{
+			StartByte:      pos,
+			OldEndByte:     pos + uint(len(from)),
+			NewEndByte:     pos + uint(len(to)),
+			StartPosition:  point,
+			OldEndPosition: advancePoint(point, from),
+			NewEndPosition: advancePoint(point, to),
+		})
+		pos += uint(len(to))
+		point = advancePoint(point, to)
+	}
+}
+
+func advancePoint(point tree_sitter.Point, text string) tree_sitter.Point {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return tree_sitter.Point{
+			Row:    point.Row + uint(strings.Count(text, "\n")),
+			Column: uint(len(text) - i - 1),
+		}
+	}
+	return tree_sitter.Point{Row: point.Row, Column: point.Column + uint(len(text))}
+}
@@ -0,0 +1,157 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// fold is a syntactic block whose lines can be collapsed. The toggle is
+// rendered in front of line toggleRow, which stays visible.
+type fold struct {
+	toggleRow uint
+	startRow  uint
+	endRow    uint
+	// key identifies the same block in the old and new version of the file
+	key string
+}
+
+var closingBrackets = map[string]string{
+	"{": "}",
+	"(": ")",
+	"[": "]",
+}
+
+// collectFolds returns a fold for every multi line block in brackets, like a
+// function body, literal or import list, and for indentation based blocks.
+// Only the outermost fold of every line is kept.
+func collectFolds(tree *tree_sitter.Tree, code []byte, defs []definition) []fold {
+	if tree == nil {
+		return nil
+	}
+
+	var folds []fold
+	byRow := make(map[uint]int)
+	ordinals := make(map[string]int)
+
+	var traverse func(*tree_sitter.Node)
+	traverse = func(n *tree_sitter.Node) {
+		if f, ok := nodeFold(n, code); ok {
+			prefix := n.Kind() + "@" + enclosingDefinition(defs, n.StartByte(), n.EndByte())
+			f.key = fmt.Sprintf("%s#%d", prefix, ordinals[prefix])
+			ordinals[prefix]++
+			if i, ok := byRow[f.toggleRow]; !ok {
+				byRow[f.toggleRow] = len(folds)
+				folds = append(folds, f)
+			} else if f.endRow > folds[i].endRow {
+				folds[i] = f
+			}
+		}
+		for i := uint(0); i < n.NamedChildCount(); i++ {
+			traverse(n.NamedChild(i))
+		}
+	}
+	traverse(tree.RootNode())
+
+	return folds
+}
+
+func nodeFold(n *tree_sitter.Node, code []byte) (fold, bool) {
+	startRow := n.StartPosition().Row
+	endRow := n.EndPosition().Row
+	if n.EndPosition().Column == 0 && endRow > startRow {
+		// a node that ends with a line break
+		endRow--
+	}
+	if endRow <= startRow {
+		return fold{}, false
+	}
+
+	if count := n.ChildCount(); count >= 2 {
+		first := n.Child(0)
+		last := n.Child(count - 1)
+		if closing, ok := closingBrackets[first.Kind()]; ok && last.Kind() == closing {
+			// keep the lines of both brackets visible
+			if last.StartPosition().Row-first.StartPosition().Row < 2 {
+				return fold{}, false
+			}
+			return fold{
+				toggleRow: first.StartPosition().Row,
+				startRow:  first.StartPosition().Row + 1,
+				endRow:    last.StartPosition().Row - 1,
+			}, true
+		}
+	}
+
+	kind := n.Kind()
+	if kind == "block" || strings.HasSuffix(kind, "_body") || kind == "body_statement" {
+		toggleRow := startRow
+		if startRow > 0 && startsLine(n, code) {
+			// like a Python block, which starts on the line after its header
+			toggleRow = startRow - 1
+		}
+		return fold{
+			toggleRow: toggleRow,
+			startRow:  toggleRow + 1,
+			endRow:    endRow,
+		}, true
+	}
+
+	return fold{}, false
+}
+
+func startsLine(n *tree_sitter.Node, code []byte) bool {
+	for i := int(n.StartByte()) - 1; i >= 0; i-- {
+		switch code[i] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func enclosingDefinition(defs []definition, start, end uint) string {
+	name := ""
+	for _, def := range defs {
+		if def.start > start {
+			break
+		}
+		// a class body with only one method isn't part of the method
+		if end <= def.end && (def.start < start || end < def.end) {
+			name = def.kind + " " + def.name
+		}
+	}
+	return name
+}
+
+func renderFoldToggle(f fold) string {
+	return fmt.Sprintf(
+		`<button type="button" class="fold-toggle" data-fold-key="%s" data-fold-start="%d" data-fold-end="%d" aria-label="Fold lines %d to %d"></button>`,
+		html.EscapeString(f.key),
+		f.startRow,
+		f.endRow,
+		f.startRow+1,
+		f.endRow+1,
+	)
+}
@@ -0,0 +1,119 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"viewre/internal/languagemapping"
+	"viewre/internal/theme"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+type highlightQuery struct {
+	query            *tree_sitter.Query
+	firstPatternWins bool
+}
+
+var (
+	highlightQueries      = make(map[string]*highlightQuery)
+	highlightQueriesMutex = &sync.Mutex{}
+)
+
+// getHighlightQuery compiles the highlights query of a language once and
+// keeps it for all following requests.
+func getHighlightQuery(lang string) (*highlightQuery, bool) {
+	highlightQueriesMutex.Lock()
+	defer highlightQueriesMutex.Unlock()
+	if hq, ok := highlightQueries[lang]; ok {
+		return hq, hq != nil
+	}
+	highlightQueries[lang] = nil
+
+	source, ok := languagemapping.GetHighlightsQuery(lang)
+	if !ok {
+		return nil, false
+	}
+	tsLang, ok := languagemapping.GetParser(lang)
+	if !ok {
+		return nil, false
+	}
+	query, queryErr := tree_sitter.NewQuery(tsLang, source.Source)
+	if queryErr != nil {
+		log.Printf("failed to compile highlights query for %q: %v", lang, queryErr)
+		return nil, false
+	}
+	hq := &highlightQuery{
+		query:            query,
+		firstPatternWins: source.FirstPatternWins,
+	}
+	highlightQueries[lang] = hq
+	return hq, true
+}
+
+type nodeCapture struct {
+	token   string
+	pattern uint
+}
+
+// captureTokens runs the highlights query of the language and returns the
+// resolved theme token for every captured node, keyed by node id.
+// Nodes captured with an unknown name like @none map to an empty token.
+func captureTokens(tree *tree_sitter.Tree, code []byte, lang string) map[uintptr]string {
+	hq, ok := getHighlightQuery(lang)
+	if !ok {
+		return nil
+	}
+
+	cursor := tree_sitter.NewQueryCursor()
+	defer cursor.Close()
+
+	captureNames := hq.query.CaptureNames()
+	captures := make(map[uintptr]nodeCapture)
+
+	matches := cursor.Matches(hq.query, tree.RootNode(), code)
+	for match := matches.Next(); match != nil; match = matches.Next() {
+		for _, capture := range match.Captures {
+			name := captureNames[capture.Index]
+			if strings.HasPrefix(name, "_") || name == "spell" {
+				continue
+			}
+			token, _ := theme.Token(name)
+			id := capture.Node.Id()
+			if existing, ok := captures[id]; ok {
+				if hq.firstPatternWins && existing.pattern <= match.PatternIndex {
+					continue
+				}
+				if !hq.firstPatternWins && existing.pattern > match.PatternIndex {
+					continue
+				}
+			}
+			captures[id] = nodeCapture{
+				token:   token,
+				pattern: match.PatternIndex,
+			}
+		}
+	}
+
+	tokens := make(map[uintptr]string, len(captures))
+	for id, capture := range captures {
+		tokens[id] = capture.token
+	}
+	return tokens
+}
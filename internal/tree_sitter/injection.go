@@ -0,0 +1,246 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"viewre/internal/languagemapping"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// maxInjectionDepth limits nested injections like markdown > html > javascript.
+const maxInjectionDepth = 3
+
+var (
+	injectionQueries      = make(map[string]*tree_sitter.Query)
+	injectionQueriesMutex = &sync.Mutex{}
+)
+
+func getInjectionQuery(lang string) (*tree_sitter.Query, bool) {
+	injectionQueriesMutex.Lock()
+	defer injectionQueriesMutex.Unlock()
+	if query, ok := injectionQueries[lang]; ok {
+		return query, query != nil
+	}
+	injectionQueries[lang] = nil
+
+	source, ok := languagemapping.GetInjectionsQuery(lang)
+	if !ok {
+		return nil, false
+	}
+	tsLang, ok := languagemapping.GetParser(lang)
+	if !ok {
+		return nil, false
+	}
+	query, queryErr := tree_sitter.NewQuery(tsLang, source)
+	if queryErr != nil {
+		log.Printf("failed to compile injections query for %q: %v", lang, queryErr)
+		return nil, false
+	}
+	injectionQueries[lang] = query
+	return query, true
+}
+
+type injection struct {
+	lang   string
+	ranges []tree_sitter.Range
+}
+
+// collectInjections finds the regions of the tree that contain code of another language.
+// Combined injections, like all code tags of an ERB template, are parsed as one document.
+func collectInjections(tree *tree_sitter.Tree, code []byte, lang string) []injection {
+	query, ok := getInjectionQuery(lang)
+	if !ok {
+		return nil
+	}
+
+	cursor := tree_sitter.NewQueryCursor()
+	defer cursor.Close()
+
+	captureNames := query.CaptureNames()
+
+	var injections []injection
+	combined := make(map[uint]int)
+
+	matches := cursor.Matches(query, tree.RootNode(), code)
+	for match := matches.Next(); match != nil; match = matches.Next() {
+		languageName := ""
+		isCombined := false
+		includeChildren := false
+		for _, property := range query.PropertySettings(match.PatternIndex) {
+			switch property.Key {
+			case "injection.language":
+				if property.Value != nil {
+					languageName = *property.Value
+				}
+			case "injection.combined":
+				isCombined = true
+			case "injection.include-children":
+				includeChildren = true
+			}
+		}
+
+		var ranges []tree_sitter.Range
+		for _, capture := range match.Captures {
+			switch captureNames[capture.Index] {
+			case "injection.language":
+				languageName = capture.Node.Utf8Text(code)
+			case "injection.content":
+				ranges = append(ranges, contentRanges(&capture.Node, includeChildren)...)
+			}
+		}
+		if len(ranges) == 0 || languageName == "" {
+			continue
+		}
+
+		injectedLang := languagemapping.GetLanguageIDByName(languageName)
+		if _, ok := languagemapping.GetParser(injectedLang); !ok {
+			continue
+		}
+
+		if isCombined {
+			if i, ok := combined[match.PatternIndex]; ok {
+				injections[i].ranges = append(injections[i].ranges, ranges...)
+				continue
+			}
+			combined[match.PatternIndex] = len(injections)
+		}
+		injections = append(injections, injection{
+			lang:   injectedLang,
+			ranges: ranges,
+		})
+	}
+
+	for _, inj := range injections {
+		sort.Slice(inj.ranges, func(i, j int) bool {
+			return inj.ranges[i].StartByte < inj.ranges[j].StartByte
+		})
+	}
+
+	return injections
+}
+
+// contentRanges returns the range of the node without its named children,
+// unless the injection includes them.
+func contentRanges(n *tree_sitter.Node, includeChildren bool) []tree_sitter.Range {
+	if includeChildren || n.NamedChildCount() == 0 {
+		return []tree_sitter.Range{n.Range()}
+	}
+	var ranges []tree_sitter.Range
+	start := n.StartByte()
+	startPoint := n.StartPosition()
+	for i := uint(0); i < n.NamedChildCount(); i++ {
+		child := n.NamedChild(i)
+		if child.StartByte() > start {
+			ranges = append(ranges, tree_sitter.Range{
+				StartByte:  start,
+				EndByte:    child.StartByte(),
+				StartPoint: startPoint,
+				EndPoint:   child.StartPosition(),
+			})
+		}
+		start = child.EndByte()
+		startPoint = child.EndPosition()
+	}
+	if n.EndByte() > start {
+		ranges = append(ranges, tree_sitter.Range{
+			StartByte:  start,
+			EndByte:    n.EndByte(),
+			StartPoint: startPoint,
+			EndPoint:   n.EndPosition(),
+		})
+	}
+	return ranges
+}
+
+// collectInjectionSpans parses all injections of the tree and returns their spans.
+func collectInjectionSpans(tree *tree_sitter.Tree, code []byte, lang string, depth int) []syntaxSpan {
+	if depth >= maxInjectionDepth {
+		return nil
+	}
+
+	var spans []syntaxSpan
+	for _, inj := range collectInjections(tree, code, lang) {
+		parser, err := getParser(inj.lang)
+		if err != nil {
+			continue
+		}
+		var injectedTree *tree_sitter.Tree
+		if err := parser.SetIncludedRanges(inj.ranges); err == nil {
+			injectedTree = parser.Parse(code, nil)
+		}
+		putParser(inj.lang, parser)
+		if injectedTree == nil {
+			continue
+		}
+		spans = append(spans, collectTreeSpans(injectedTree, code, inj.lang, depth+1)...)
+		injectedTree.Close()
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	return spans
+}
+
+// overlaySpans puts the spans of injected code on top of the spans of the outer tree.
+// Outer spans are cut where they overlap, and injected spans without a token of
+// their own keep the token of the outer span they are in.
+func overlaySpans(base []syntaxSpan, overlay []syntaxSpan) []syntaxSpan {
+	if len(overlay) == 0 {
+		return base
+	}
+
+	spans := make([]syntaxSpan, 0, len(base)+len(overlay))
+	first := 0
+	for _, b := range base {
+		for first < len(overlay) && overlay[first].end <= b.start {
+			first++
+		}
+		pos := b.start
+		for i := first; i < len(overlay) && overlay[i].start < b.end; i++ {
+			o := overlay[i]
+			if o.token == "" && o.start >= b.start && o.end <= b.end {
+				o.token = b.token
+				overlay[i] = o
+			}
+			if o.start > pos {
+				fragment := b
+				fragment.start = pos
+				fragment.end = o.start
+				spans = append(spans, fragment)
+			}
+			pos = max(pos, o.end)
+		}
+		if pos < b.end {
+			fragment := b
+			fragment.start = pos
+			spans = append(spans, fragment)
+		}
+	}
+	spans = append(spans, overlay...)
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	return spans
+}
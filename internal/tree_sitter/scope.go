@@ -0,0 +1,119 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// scopeMarkers finds the innermost definition around the first character of
+// every line and returns it as a breadcrumb like "class Review › method Stop",
+// keyed by the offset of the line. Only lines whose scope differs from the
+// line before get an entry, blank lines keep the scope they are in.
+func scopeMarkers(code []byte, defs []definition) map[uint]string {
+	markers := make(map[uint]string)
+	if len(defs) == 0 {
+		return markers
+	}
+
+	var stack []definition
+	next := 0
+	current := ""
+	lineStart := uint(0)
+	for lineStart < uint(len(code)) {
+		lineEnd := lineStart
+		for lineEnd < uint(len(code)) && code[lineEnd] != '\n' {
+			lineEnd++
+		}
+		pos := lineStart
+		for pos < lineEnd && (code[pos] == ' ' || code[pos] == '\t' || code[pos] == '\r') {
+			pos++
+		}
+		if pos < lineEnd {
+			for len(stack) > 0 && stack[len(stack)-1].end <= pos {
+				stack = stack[:len(stack)-1]
+			}
+			for next < len(defs) && defs[next].start <= pos {
+				if defs[next].end > pos && isScope(defs[next]) {
+					stack = append(stack, defs[next])
+				}
+				next++
+			}
+			if scope := breadcrumb(stack); scope != current {
+				markers[lineStart] = scope
+				current = scope
+			}
+		}
+		lineStart = lineEnd + 1
+	}
+	return markers
+}
+
+func isScope(def definition) bool {
+	switch def.kind {
+	case "const", "field", "variant":
+		return false
+	default:
+		return true
+	}
+}
+
+func breadcrumb(stack []definition) string {
+	parts := make([]string, len(stack))
+	for i, def := range stack {
+		parts[i] = def.kind + " " + def.label
+	}
+	return strings.Join(parts, " › ")
+}
+
+// splitSegments cuts the segments at the offsets of the scope markers, so
+// that every marker can be rendered in front of a segment.
+func splitSegments(segments []highlightedSegment, markers map[uint]string) []highlightedSegment {
+	if len(markers) == 0 {
+		return segments
+	}
+	offsets := make([]uint, 0, len(markers))
+	for offset := range markers {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	split := make([]highlightedSegment, 0, len(segments)+len(offsets))
+	i := 0
+	for _, segment := range segments {
+		for i < len(offsets) && offsets[i] <= segment.start {
+			i++
+		}
+		for i < len(offsets) && offsets[i] < segment.end {
+			head := segment
+			head.end = offsets[i]
+			split = append(split, head)
+			segment.start = offsets[i]
+			i++
+		}
+		split = append(split, segment)
+	}
+	return split
+}
+
+func renderScopeMarker(scope string) string {
+	return `<span class="scope-marker" data-scope="` + html.EscapeString(scope) + `"></span>`
+}
@@ -0,0 +1,359 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package tree_sitter
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"viewre/internal/languagemapping"
+	"viewre/internal/repository"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+)
+
+var (
+	tagsQueries      = make(map[string]*tree_sitter.Query)
+	tagsQueriesMutex = &sync.Mutex{}
+)
+
+func getTagsQuery(lang string) (*tree_sitter.Query, bool) {
+	tagsQueriesMutex.Lock()
+	defer tagsQueriesMutex.Unlock()
+	if query, ok := tagsQueries[lang]; ok {
+		return query, query != nil
+	}
+	tagsQueries[lang] = nil
+
+	source, ok := languagemapping.GetTagsQuery(lang)
+	if !ok {
+		return nil, false
+	}
+	tsLang, ok := languagemapping.GetParser(lang)
+	if !ok {
+		return nil, false
+	}
+	query, queryErr := tree_sitter.NewQuery(tsLang, source)
+	if queryErr != nil {
+		log.Printf("failed to compile tags query for %q: %v", lang, queryErr)
+		return nil, false
+	}
+	tagsQueries[lang] = query
+	return query, true
+}
+
+// SymbolChange is a definition that was added, modified or removed by a diff.
+type SymbolChange struct {
+	// Change is "added", "modified" or "removed".
+	Change string
+	Kind   string
+	// Name is qualified with the names of the enclosing definitions, like Class.method.
+	Name string
+}
+
+func (c SymbolChange) String() string {
+	return c.Change + " " + c.Kind + " " + c.Name
+}
+
+type definition struct {
+	kind string
+	// label is the name without the names of the enclosing definitions.
+	label  string
+	name   string
+	start  uint
+	end    uint
+	parent int
+}
+
+func (d definition) key() string {
+	return d.kind + " " + d.name
+}
+
+type byteRange struct {
+	start uint
+	end   uint
+}
+
+// ChangedSymbols intersects the changed lines of a file with the definitions
+// of the old and new version of the file.
+func ChangedSymbols(filePatch diff.FilePatch) []SymbolChange {
+	if filePatch == nil || filePatch.IsBinary() {
+		return nil
+	}
+	from, to := filePatch.Files()
+	if from == nil {
+		from = nullFile{}
+	}
+	if to == nil {
+		to = nullFile{}
+	}
+
+	fromCode, toCode := repository.FileContent(filePatch)
+	fromLang := languagemapping.DetectLanguageID(from.Path(), fromCode)
+	toLang := languagemapping.DetectLanguageID(to.Path(), toCode)
+	if _, ok := getTagsQuery(fromLang); !ok {
+		if _, ok := getTagsQuery(toLang); !ok {
+			return nil
+		}
+	}
+	fromFile, toFile := highlightFiles(filePatch, from, to, fromCode, toCode, fromLang, toLang)
+	fromDefs := fromFile.defs
+	toDefs := toFile.defs
+	if len(fromDefs) == 0 && len(toDefs) == 0 {
+		return nil
+	}
+
+	var fromChanged, toChanged []byteRange
+	fromOffset := uint(0)
+	toOffset := uint(0)
+	for _, chunk := range filePatch.Chunks() {
+		fromContent, toContent := repository.ChunkContent(chunk)
+		fromLength := uint(len(fromContent))
+		toLength := uint(len(toContent))
+		switch chunk.Type() {
+		case diff.Add:
+			toChanged = append(toChanged, byteRange{toOffset, toOffset + toLength})
+		case diff.Delete:
+			fromChanged = append(fromChanged, byteRange{fromOffset, fromOffset + fromLength})
+		}
+		if chunk.Type() != diff.Add {
+			fromOffset += fromLength
+		}
+		if chunk.Type() != diff.Delete {
+			toOffset += toLength
+		}
+	}
+
+	fromKeys := groupDefinitions(fromDefs)
+	toKeys := groupDefinitions(toDefs)
+
+	var changes []SymbolChange
+	seen := make(map[string]bool)
+	for _, def := range toDefs {
+		key := def.key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := fromKeys[key]; !ok {
+			// the children of an added definition are added too
+			if def.parent < 0 || hasKey(fromKeys, toDefs[def.parent].key()) {
+				changes = append(changes, SymbolChange{"added", def.kind, def.name})
+			}
+			continue
+		}
+		if anyModified(toDefs, toKeys[key], toChanged) || anyModified(fromDefs, fromKeys[key], fromChanged) {
+			changes = append(changes, SymbolChange{"modified", def.kind, def.name})
+		}
+	}
+	for _, def := range fromDefs {
+		key := def.key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if def.parent < 0 || hasKey(toKeys, fromDefs[def.parent].key()) {
+			changes = append(changes, SymbolChange{"removed", def.kind, def.name})
+		}
+	}
+	return changes
+}
+
+// treeDefinitions returns the definitions found by the tags query of the
+// language, sorted by position. Definitions inside of functions are left out.
+func treeDefinitions(tree *tree_sitter.Tree, code []byte, lang string) []definition {
+	if tree == nil {
+		return nil
+	}
+	query, ok := getTagsQuery(lang)
+	if !ok {
+		return nil
+	}
+
+	cursor := tree_sitter.NewQueryCursor()
+	defer cursor.Close()
+
+	captureNames := query.CaptureNames()
+
+	var defs []definition
+	byNode := make(map[uintptr]int)
+
+	matches := cursor.Matches(query, tree.RootNode(), code)
+	for match := matches.Next(); match != nil; match = matches.Next() {
+		var node *tree_sitter.Node
+		kind := ""
+		name := ""
+		for _, capture := range match.Captures {
+			captureName := captureNames[capture.Index]
+			if captureName == "name" {
+				name = capture.Node.Utf8Text(code)
+			} else if k, ok := strings.CutPrefix(captureName, "definition."); ok {
+				n := capture.Node
+				node = &n
+				kind = k
+			} else if captureName == "reference.implementation" && capture.Node.Kind() == "impl_item" {
+				// Rust impl blocks are only tagged as references, but they group methods like a class
+				n := capture.Node
+				node = &n
+				kind = "impl"
+			}
+		}
+		if kind == "impl" {
+			if t := node.ChildByFieldName("type"); t != nil {
+				name = t.Utf8Text(code)
+			}
+		}
+		if node == nil || name == "" {
+			continue
+		}
+		node = definitionNode(node)
+		// a node can match more than one pattern, like a Rust function that is a method
+		if i, ok := byNode[node.Id()]; ok {
+			if kind == "method" {
+				defs[i].kind = kind
+			}
+			continue
+		}
+		byNode[node.Id()] = len(defs)
+		defs = append(defs, definition{
+			kind:  kind,
+			label: strings.TrimSpace(name),
+			name:  strings.TrimSpace(name),
+			start: node.StartByte(),
+			end:   node.EndByte(),
+		})
+	}
+
+	sort.SliceStable(defs, func(i, j int) bool {
+		if defs[i].start != defs[j].start {
+			return defs[i].start < defs[j].start
+		}
+		return defs[i].end > defs[j].end
+	})
+
+	kept := make([]definition, 0, len(defs))
+	var stack []int
+	for _, def := range defs {
+		for len(stack) > 0 && kept[stack[len(stack)-1]].end <= def.start {
+			stack = stack[:len(stack)-1]
+		}
+		def.parent = -1
+		if len(stack) > 0 {
+			parent := kept[stack[len(stack)-1]]
+			if def.end > parent.end {
+				continue
+			}
+			switch parent.kind {
+			case "function", "method", "operator":
+				continue
+			case "class", "interface", "impl":
+				if def.kind == "function" {
+					def.kind = "method"
+				}
+			}
+			def.parent = stack[len(stack)-1]
+			def.name = parent.name + "." + def.name
+		}
+		stack = append(stack, len(kept))
+		kept = append(kept, def)
+	}
+
+	for i, def := range kept {
+		kept[i].kind = kindLabel(def.kind)
+	}
+	return kept
+}
+
+// definitionNode widens a captured declarator, like the one of a C function,
+// to the whole definition so that changes to the body are inside of it.
+func definitionNode(node *tree_sitter.Node) *tree_sitter.Node {
+	n := node
+	for strings.HasSuffix(n.Kind(), "_declarator") {
+		parent := n.Parent()
+		if parent == nil {
+			return node
+		}
+		n = parent
+	}
+	if n != node && n.Kind() == "function_definition" {
+		return n
+	}
+	return node
+}
+
+func kindLabel(kind string) string {
+	switch kind {
+	case "function":
+		return "func"
+	case "constant":
+		return "const"
+	case "enum_variant":
+		return "variant"
+	default:
+		return kind
+	}
+}
+
+func groupDefinitions(defs []definition) map[string][]int {
+	groups := make(map[string][]int, len(defs))
+	for i, def := range defs {
+		groups[def.key()] = append(groups[def.key()], i)
+	}
+	return groups
+}
+
+func hasKey(groups map[string][]int, key string) bool {
+	_, ok := groups[key]
+	return ok
+}
+
+// anyModified reports whether a changed range touches one of the definitions
+// outside of the definitions nested in it, which report their own changes.
+func anyModified(defs []definition, group []int, changed []byteRange) bool {
+	for _, i := range group {
+		def := defs[i]
+		var children []definition
+		for _, child := range defs[i+1:] {
+			if child.start >= def.end {
+				break
+			}
+			if child.parent == i {
+				children = append(children, child)
+			}
+		}
+		for _, r := range changed {
+			start := max(r.start, def.start)
+			end := min(r.end, def.end)
+			for _, child := range children {
+				if start >= end {
+					break
+				}
+				if child.start > start {
+					break
+				}
+				start = max(start, child.end)
+			}
+			if start < end {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -17,12 +17,15 @@
 package tree_sitter
 
 import (
+	"bytes"
 	"fmt"
 	"html"
-	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"viewre/internal/languagemapping"
+	"viewre/internal/repository"
+	"viewre/internal/theme"
 
 	tree_sitter "github.com/tree-sitter/go-tree-sitter"
 
@@ -31,18 +34,65 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/format/diff"
 )
 
-func parse(code []byte, lang string, oldTree *tree_sitter.Tree) (*tree_sitter.Tree, error) {
-	parser := tree_sitter.NewParser()
-	defer parser.Close()
-	if tsLang, ok := languagemapping.GetParser(lang); !ok {
+// idleParsers keeps a few parsers of every language for the next request,
+// creating a parser is more expensive than parsing a small file. Parsers
+// have no finalizer, so they can't be kept in a sync.Pool.
+var (
+	idleParsers      = make(map[string]chan *tree_sitter.Parser)
+	idleParsersMutex = &sync.Mutex{}
+)
+
+const maxIdleParsers = 4
+
+func idleParserPool(lang string) chan *tree_sitter.Parser {
+	idleParsersMutex.Lock()
+	defer idleParsersMutex.Unlock()
+	pool, ok := idleParsers[lang]
+	if !ok {
+		pool = make(chan *tree_sitter.Parser, maxIdleParsers)
+		idleParsers[lang] = pool
+	}
+	return pool
+}
+
+// getParser takes an idle parser of the language or creates a new one.
+func getParser(lang string) (*tree_sitter.Parser, error) {
+	tsLang, ok := languagemapping.GetParser(lang)
+	if !ok {
 		return nil, fmt.Errorf("unknown language %q", lang)
-	} else {
-		if err := parser.SetLanguage(tsLang); err != nil {
-			return nil, err
-		}
 	}
-	tree := parser.Parse(code, oldTree)
-	return tree, nil
+	select {
+	case parser := <-idleParserPool(lang):
+		return parser, nil
+	default:
+	}
+	parser := tree_sitter.NewParser()
+	if err := parser.SetLanguage(tsLang); err != nil {
+		parser.Close()
+		return nil, err
+	}
+	return parser, nil
+}
+
+// putParser keeps the parser for the next request if the pool isn't full.
+func putParser(lang string, parser *tree_sitter.Parser) {
+	parser.Reset()
+	// injections only parse parts of the document
+	_ = parser.SetIncludedRanges(nil)
+	select {
+	case idleParserPool(lang) <- parser:
+	default:
+		parser.Close()
+	}
+}
+
+func parse(code []byte, lang string, oldTree *tree_sitter.Tree) (*tree_sitter.Tree, error) {
+	parser, err := getParser(lang)
+	if err != nil {
+		return nil, err
+	}
+	defer putParser(lang, parser)
+	return parser.Parse(code, oldTree), nil
 }
 
 type nullFile struct{}
@@ -62,10 +112,8 @@ func (nullFile) Path() string {
 	return ""
 }
 
-func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
-	if filePatch == nil {
-		return
-	}
+// Header renders the git style header lines of a file patch.
+func Header(filePatch diff.FilePatch) string {
 	from, to := filePatch.Files()
 	if from == nil {
 		from = nullFile{}
@@ -91,47 +139,38 @@ func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
 		headerBuilder.WriteString(html.EscapeString(fmt.Sprintf("+++ w/%s", to.Path())))
 	}
 	headerBuilder.WriteString("</p>")
-	header = headerBuilder.String()
-
-	fromFullContentBuilder := strings.Builder{}
-	toFullContentBuilder := strings.Builder{}
-	for _, chunk := range filePatch.Chunks() {
-		switch chunk.Type() {
-		case diff.Equal:
-			fromFullContentBuilder.WriteString(chunk.Content())
-			toFullContentBuilder.WriteString(chunk.Content())
-		case diff.Add:
-			toFullContentBuilder.WriteString(chunk.Content())
-		case diff.Delete:
-			fromFullContentBuilder.WriteString(chunk.Content())
-		}
-	}
+	return headerBuilder.String()
+}
 
-	fromCode := []byte(fromFullContentBuilder.String())
-	toCode := []byte(toFullContentBuilder.String())
+func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
+	return PatchWithGutter(a, b, filePatch, nil)
+}
 
-	fromLang := languagemapping.GetLanguageID(filepath.Base(from.Path()))
-	toLang := languagemapping.GetLanguageID(filepath.Base(to.Path()))
+// PatchWithGutter renders a patch like Patch, with the HTML returned by
+// toGutter in front of every line of the new version.
+func PatchWithGutter(a, b string, filePatch diff.FilePatch, toGutter Gutter) (header string, body string) {
+	if filePatch == nil {
+		return
+	}
+	header = Header(filePatch)
 
-	fromTree, err := parse(fromCode, fromLang, nil)
-	if err != nil {
-		fromTree = nil
+	from, to := filePatch.Files()
+	if from == nil {
+		from = nullFile{}
+	}
+	if to == nil {
+		to = nullFile{}
 	}
 
-	fromSegments := renderWithHighlighting(
-		fromCode,
-		collectSpans(fromTree),
-	)
+	fromCode, toCode := repository.FileContent(filePatch)
 
-	toTree, err := parse(toCode, toLang, nil)
-	if err != nil {
-		toTree = nil
-	}
+	fromLang := languagemapping.DetectLanguageID(from.Path(), fromCode)
+	toLang := languagemapping.DetectLanguageID(to.Path(), toCode)
 
-	toSegments := renderWithHighlighting(
-		toCode,
-		collectSpans(toTree),
-	)
+	fromFile, toFile := highlightFiles(filePatch, from, to, fromCode, toCode, fromLang, toLang)
+	fromSide := newSideRenderer(fromFile, fromCode)
+	toSide := newSideRenderer(toFile, toCode)
+	toSide.gutter = toGutter
 
 	fromOffset := uint(0)
 	toOffset := uint(0)
@@ -143,7 +182,9 @@ func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
 	rightDiff := 0
 
 	for _, chunk := range filePatch.Chunks() {
-		chunkLength := uint(len([]byte(chunk.Content())))
+		fromContent, toContent := repository.ChunkContent(chunk)
+		fromLength := uint(len(fromContent))
+		toLength := uint(len(toContent))
 
 		switch chunk.Type() {
 		case diff.Equal:
@@ -155,33 +196,44 @@ func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
 			}
 			leftDiff = 0
 			rightDiff = 0
-			bodyLeftBuilder.WriteString(`<div class="chunk chunk--left chunk--equal">`)
-			bodyLeftBuilder.WriteString(render(fromSegments, fromOffset, fromOffset+chunkLength, fromCode))
-			bodyLeftBuilder.WriteString(`</div>`)
-			bodyRightBuilder.WriteString(`<div class="chunk chunk--equal">`)
-			bodyRightBuilder.WriteString(render(toSegments, toOffset, toOffset+chunkLength, toCode))
-			bodyRightBuilder.WriteString(`</div>`)
-			fromOffset += chunkLength
-			toOffset += chunkLength
+			class := "chunk--equal"
+			if _, ok := chunk.(repository.WhitespaceChunk); ok {
+				// lines that only differ in ignored whitespace, the sides can have a different number of lines
+				class += " chunk--whitespace"
+				leftDiff += countLineBreaks(fromContent)
+				rightDiff += countLineBreaks(toContent)
+			}
+			if fromLength > 0 {
+				bodyLeftBuilder.WriteString(`<div class="chunk chunk--left ` + class + `">`)
+				bodyLeftBuilder.WriteString(fromSide.render(fromOffset, fromOffset+fromLength))
+				bodyLeftBuilder.WriteString(`</div>`)
+			}
+			if toLength > 0 {
+				bodyRightBuilder.WriteString(`<div class="chunk ` + class + `">`)
+				bodyRightBuilder.WriteString(toSide.render(toOffset, toOffset+toLength))
+				bodyRightBuilder.WriteString(`</div>`)
+			}
+			fromOffset += fromLength
+			toOffset += toLength
 
 		case diff.Add:
 			bodyRightBuilder.WriteString(`<div class="chunk chunk--add">`)
-			bodyRightBuilder.WriteString(render(toSegments, toOffset, toOffset+chunkLength, toCode))
+			bodyRightBuilder.WriteString(toSide.render(toOffset, toOffset+toLength))
 			bodyRightBuilder.WriteString(`</div>`)
-			toOffset += chunkLength
-			rightDiff = countLineBreaks(chunk.Content())
+			toOffset += toLength
+			rightDiff += countLineBreaks(toContent)
 
 		case diff.Delete:
 			bodyLeftBuilder.WriteString(`<div class="chunk chunk--delete">`)
-			bodyLeftBuilder.WriteString(render(fromSegments, fromOffset, fromOffset+chunkLength, fromCode))
+			bodyLeftBuilder.WriteString(fromSide.render(fromOffset, fromOffset+fromLength))
 			bodyLeftBuilder.WriteString(`</div>`)
-			fromOffset += chunkLength
-			leftDiff = countLineBreaks(chunk.Content())
+			fromOffset += fromLength
+			leftDiff += countLineBreaks(fromContent)
 		}
 	}
 
 	body = fmt.Sprintf(
-		`<div class="diff"><div class="diff__left" data-file="%s" data-commit="%s">%s</div><div class="diff__right" data-file="%s" data-commit="%s">%s</div></div>`,
+		`<div class="diff"><div class="diff__scope diff__scope--left"></div><div class="diff__scope diff__scope--right"></div><div class="diff__left" data-file="%s" data-commit="%s">%s</div><div class="diff__right" data-file="%s" data-commit="%s">%s</div></div>`,
 		from.Path(),
 		a,
 		bodyLeftBuilder.String(),
@@ -193,162 +245,146 @@ func Patch(a, b string, filePatch diff.FilePatch) (header string, body string) {
 	return
 }
 
+// File renders a whole file outside of a diff. It uses the markup of the
+// left side of a diff, so that hover, folding and the scope breadcrumb work.
+// gutter may be nil.
+func File(commit, path string, hash plumbing.Hash, code []byte, gutter Gutter) string {
+	lang := languagemapping.DetectLanguageID(path, code)
+	file, tree := loadHighlightedFile(hash, code, lang, nil)
+	if tree != nil {
+		tree.Close()
+	}
+	side := newSideRenderer(file, code)
+	side.gutter = gutter
+	return fmt.Sprintf(
+		`<div class="diff diff--single"><div class="diff__scope diff__scope--left"></div><div class="diff__left" data-file="%s" data-commit="%s"><div class="chunk">%s</div></div></div>`,
+		html.EscapeString(path),
+		html.EscapeString(commit),
+		side.render(0, uint(len(code))),
+	)
+}
+
+// highlightFiles highlights both versions of a file. If the new version
+// isn't cached, it is parsed incrementally from the tree of the old version.
+func highlightFiles(filePatch diff.FilePatch, from, to diff.File, fromCode, toCode []byte, fromLang, toLang string) (*highlightedFile, *highlightedFile) {
+	fromFile, fromTree := loadHighlightedFile(from.Hash(), fromCode, fromLang, nil)
+	var oldTree *tree_sitter.Tree
+	if fromTree != nil {
+		defer fromTree.Close()
+		if fromLang == toLang {
+			oldTree = fromTree.Clone()
+			defer oldTree.Close()
+			editTree(oldTree, filePatch.Chunks())
+		}
+	}
+	toFile, toTree := loadHighlightedFile(to.Hash(), toCode, toLang, oldTree)
+	if toTree != nil {
+		toTree.Close()
+	}
+	return fromFile, toFile
+}
+
 type syntaxSpan struct {
 	start       uint
 	end         uint
+	token       string
 	class       string
 	kind        string
 	grammarname string
 }
 
-func getNodeClass(nodeType string) (string, bool) {
-	switch nodeType {
-	case "comment", "comment_content", "line_comment", "block_comment", "//", "shebang", "--":
-		return "text-neutral-400", true
-
-	case "string", "string_start", "string_end", "string_content", "string_fragment", "string_literal_content", "string_literal", "raw_string_literal", "interpreted_string_literal", "interpreted_string_literal_content", "\"", "'", "`", "fenced_code_block_delimiter", "indented_code_block", "fenced_code_block", "link_title", "attribute_value":
-		return "text-green-400", true
-
-	case "link_destination", "link_label":
-		return "text-blue-400 underline", true
-
-	case "escape_sequence", "backslash_escape":
-		return "text-lime-400", true
-
-	case "block_continuation", "block_quote_marker":
-		return "text-emerald-400", true
-
-	case "number", "int", "float", "int_literal", "integer_literal", "float_literal", "rune_literal", "chan", "decimal_integer_literal", "hex_integer_literal", "octal_integer_literal", "binary_integer_literal", "true", "false":
-		return "text-amber-400", true
-
-	case "field_identifier", "attribute_name":
-		return "text-blue-400", true
-
-	case "_line":
-		return "text-pink-400", true
-
-	case "identifier", "tag_name":
-		return "text-white", true
-
-	case "type_identifier", "language", "void_type":
-		return "text-yellow-400", true
-	case "predefined_type":
-		return "text-amber-400", true
-
-	case "export":
-		return "text-cyan-400", true
-
-	case "import", "from", "as", "require", "package", "class", "def", "interface", "enum", "type", "function", "fn", "fun", "func", "go", "var", "let", "const", "async", "await", "break", "case", "catch", "continue", "debugger", "default", "delete", "do", "else", "finally", "for", "if", "in", "instanceof", "new", "return", "switch", "this", "throw", "try", "typeof", "void", "while", "with", "yield", "private", "public", "protected", "internal", "pub", "use", "mod", "mut", "satisfies", "override", "readonly", "namespace", "keyof", "implements", "abstract", "declare", "using", "static", "except", "local", "then", "end", "elseif":
-		return "text-indigo-400", true
-
-	case "assembly", "get", "set":
-		return "text-purple-400", true
-
-	case "operator", ":=", "=", "+", "-", "~", "*", "/", "%", "==", "!=", "===", "!==", "=>", "==>", "<-", "->", "<<", ">>", "<", ">", "/>", "</", "<=", ">=", "&&", "||", "!", "|", "&", "$", "@":
-		return "text-cyan-400", true
-
-	case "#if", "#else", "#elif", "#endif", "#ifdef", "#ifndef", "#include":
-		return "text-rose-400", true
+func collectSpans(tree *tree_sitter.Tree, code []byte, lang string) []syntaxSpan {
+	if tree == nil {
+		return nil
+	}
 
-	case "list_marker_plus", "list_marker_minus", "list_marker_star", "list_marker_dot", "list_marker_parenthesis", "thematic_break":
-		return "text-red-300", true
+	spans := collectTreeSpans(tree, code, lang, 0)
 
-	case "punctuation", "(", ")", "[", "]", "{", "}", ";", "?", ":", ",", ".", "...", "..", "::", "#", "atx_h1_marker", "atx_h2_marker", "atx_h3_marker", "atx_h4_marker", "atx_h5_marker", "atx_h6_marker", "setext_h1_underline", "setext_h2_underline":
-		return "text-gray-400", true
+	rainbowBrackets := 0
 
-	default:
-		return "text-white", false
+	for i, span := range spans {
+		switch span.kind {
+		case "(", "[", "{":
+			span.class = theme.RainbowClass(rainbowBrackets)
+			rainbowBrackets++
+		case ")", "]", "}":
+			rainbowBrackets--
+			span.class = theme.RainbowClass(rainbowBrackets)
+		default:
+			span.class = "ts-node"
+			if span.token != "" {
+				span.class = theme.Class(span.token) + " " + span.class
+			}
+		}
+		spans[i] = span
 	}
-}
 
-func getRainbowBracketClass(index int) string {
-	switch index % 11 {
-	case 0:
-		return "text-yellow-300"
-	case 1:
-		return "text-green-300"
-	case 2:
-		return "text-cyan-300"
-	case 3:
-		return "text-violet-300"
-	case 4:
-		return "text-orange-300"
-	case 5:
-		return "text-lime-300"
-	case 6:
-		return "text-blue-300"
-	case 7:
-		return "text-red-300"
-	case 8:
-		return "text-teal-300"
-	case 9:
-		return "text-fuchsia-300"
-	case 10:
-		return "text-lime-300"
-	}
-	return "text-gray-300"
+	return spans
 }
 
-func collectSpans(tree *tree_sitter.Tree) []syntaxSpan {
-	if tree == nil {
-		return nil
-	}
+// collectTreeSpans returns the highlighted leaves of the tree merged with the
+// spans of all embedded code found by the injections query of the language.
+func collectTreeSpans(tree *tree_sitter.Tree, code []byte, lang string, depth int) []syntaxSpan {
+	tokens := captureTokens(tree, code, lang)
 
 	var spans []syntaxSpan
 
-	var traverse func(*tree_sitter.Node)
-	traverse = func(n *tree_sitter.Node) {
+	// the token of the innermost captured ancestor applies to a leaf
+	var traverse func(*tree_sitter.Node, string)
+	traverse = func(n *tree_sitter.Node, token string) {
+		if t, ok := tokens[n.Id()]; ok {
+			token = t
+		}
 		if n.ChildCount() == 0 {
-			class, ok := getNodeClass(n.Kind())
-			if !ok {
-				class, _ = getNodeClass(n.GrammarName())
-			}
-			class += " ts-node"
 			spans = append(spans, syntaxSpan{
 				start:       n.StartByte(),
 				end:         n.EndByte(),
-				class:       class,
+				token:       token,
 				grammarname: n.GrammarName(),
 				kind:        n.Kind(),
 			})
-		} else {
-			for i := uint(0); i < n.ChildCount(); i++ {
-				child := n.Child(uint(i))
-				traverse(child)
+			return
+		}
+		pos := n.StartByte()
+		for i := uint(0); i < n.ChildCount(); i++ {
+			child := n.Child(uint(i))
+			// text of a captured node that isn't covered by any child, like the words of an emphasis
+			if token != "" && child.StartByte() > pos {
+				spans = append(spans, syntaxSpan{
+					start:       pos,
+					end:         child.StartByte(),
+					token:       token,
+					grammarname: n.GrammarName(),
+					kind:        n.Kind(),
+				})
 			}
+			traverse(child, token)
+			pos = max(pos, child.EndByte())
+		}
+		if token != "" && n.EndByte() > pos {
+			spans = append(spans, syntaxSpan{
+				start:       pos,
+				end:         n.EndByte(),
+				token:       token,
+				grammarname: n.GrammarName(),
+				kind:        n.Kind(),
+			})
 		}
 	}
 
-	traverse(tree.RootNode())
+	traverse(tree.RootNode(), "")
 
 	sort.Slice(spans, func(i, j int) bool {
 		return spans[i].start < spans[j].start
 	})
 
-	rainbowBrackets := 0
-
-	for i, span := range spans {
-		switch span.kind {
-		case "(", "[", "{":
-			span.class = getRainbowBracketClass(rainbowBrackets)
-			spans[i] = span
-			rainbowBrackets++
-		case ")", "]", "}":
-			rainbowBrackets--
-			span.class = getRainbowBracketClass(rainbowBrackets)
-			spans[i] = span
-		}
-	}
-
-	return spans
+	return overlaySpans(spans, collectInjectionSpans(tree, code, lang, depth))
 }
 
 func renderWithHighlighting(code []byte, spans []syntaxSpan) []highlightedSegment {
 	if len(spans) == 0 {
 		return []highlightedSegment{
 			{
-				text:  string(code),
-				class: "text-white",
 				start: 0,
 				end:   uint(len(code)),
 			},
@@ -361,14 +397,11 @@ func renderWithHighlighting(code []byte, spans []syntaxSpan) []highlightedSegmen
 	for _, span := range spans {
 		if pos < span.start {
 			segments = append(segments, highlightedSegment{
-				text:  string(code[pos:span.start]),
-				class: "text-white",
 				start: pos,
 				end:   span.start,
 			})
 		}
 		segments = append(segments, highlightedSegment{
-			text:        string(code[span.start:span.end]),
 			class:       span.class,
 			start:       span.start,
 			end:         span.end,
@@ -381,8 +414,6 @@ func renderWithHighlighting(code []byte, spans []syntaxSpan) []highlightedSegmen
 	if pos < uint(len(code)) {
 		end := uint(len(code))
 		segments = append(segments, highlightedSegment{
-			text:  string(code[pos:]),
-			class: "text-white",
 			start: pos,
 			end:   end,
 		})
@@ -392,7 +423,6 @@ func renderWithHighlighting(code []byte, spans []syntaxSpan) []highlightedSegmen
 }
 
 type highlightedSegment struct {
-	text        string
 	class       string
 	start       uint
 	end         uint
@@ -404,17 +434,83 @@ func countLineBreaks(s string) int {
 	return strings.Count(s, "\n")
 }
 
-func render(segments []highlightedSegment, windowStart uint, windowEnd uint, code []byte) string {
+// Gutter returns the HTML in front of a line, rows start at 0.
+type Gutter func(row uint) string
+
+// sideRenderer renders the lines of one version of a file, chunk by chunk.
+type sideRenderer struct {
+	file   *highlightedFile
+	code   []byte
+	folds  map[uint][]fold
+	row    uint
+	gutter Gutter
+}
+
+func newSideRenderer(file *highlightedFile, code []byte) *sideRenderer {
+	folds := make(map[uint][]fold, len(file.folds))
+	for _, f := range file.folds {
+		folds[f.toggleRow] = append(folds[f.toggleRow], f)
+	}
+	return &sideRenderer{
+		file:  file,
+		code:  code,
+		folds: folds,
+	}
+}
+
+// render renders every line of the window in its own element, so that
+// folded lines can be hidden. The window has to start at the beginning of a
+// line that follows the previously rendered window.
+func (r *sideRenderer) render(windowStart uint, windowEnd uint) string {
+	linesBuilder := strings.Builder{}
+	for start := windowStart; start < windowEnd; r.row++ {
+		end := windowEnd
+		if i := bytes.IndexByte(r.code[start:windowEnd], '\n'); i >= 0 {
+			end = start + uint(i) + 1
+		}
+		linesBuilder.WriteString(fmt.Sprintf(`<span class="line" data-line="%d">`, r.row))
+		if r.gutter != nil {
+			linesBuilder.WriteString(r.gutter(r.row))
+		}
+		for _, f := range r.folds[r.row] {
+			linesBuilder.WriteString(renderFoldToggle(f))
+		}
+		linesBuilder.WriteString(render(r.file.segments, start, end, r.code, r.file.markers))
+		linesBuilder.WriteString(`</span>`)
+		start = end
+	}
+	return linesBuilder.String()
+}
+
+func render(segments []highlightedSegment, windowStart uint, windowEnd uint, code []byte, markers map[uint]string) string {
 	chunkBuilder := strings.Builder{}
 
-	for _, segment := range segments {
-		if segment.end < windowStart || segment.start > windowEnd {
+	// segments are sorted and don't overlap
+	first := sort.Search(len(segments), func(i int) bool {
+		return segments[i].start >= windowStart
+	})
+	for first > 0 && segments[first-1].end >= windowStart {
+		first--
+	}
+
+	for _, segment := range segments[first:] {
+		if segment.start > windowEnd {
+			break
+		}
+		if segment.end < windowStart {
 			continue
 		}
 		s := max(segment.start, windowStart)
 		e := min(segment.end, windowEnd)
+		if s >= e {
+			continue
+		}
 		slice := code[s:e]
 
+		if scope, ok := markers[s]; ok && s == segment.start {
+			chunkBuilder.WriteString(renderScopeMarker(scope))
+		}
+
 		chunkBuilder.WriteString(fmt.Sprintf(
 			`<span class="%s" data-start="%d" data-end="%d" data-kind="%s" data-grammarname="%s">%s</span>`,
 			segment.class,
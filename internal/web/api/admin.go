@@ -18,8 +18,10 @@ package api
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"viewre/internal/db"
+	"viewre/internal/repository"
 )
 
 func encodeSshKey(key string) []byte {
@@ -39,21 +41,30 @@ func AdminRepoHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		db.Repos.Lock()
-		defer db.Repos.Unlock()
-		if _, ok := db.Repos.Get(repoName); !ok {
+		_, ok := db.Repos.Get(repoName)
+		if ok {
+			db.Repos.Delete(repoName)
+		}
+		db.Repos.Unlock()
+		if !ok {
 			http.Error(w, "Repo not found", http.StatusNotFound)
 			return
 		}
-		db.Repos.Delete(repoName)
+		// the files are deleted without holding db.Repos, because a running
+		// fetch can keep the mirror locked for a while
+		if err := repository.RemoveRepo(r.Context(), repoName); err != nil {
+			log.Printf("failed to delete files of repo %s: %v", repoName, err)
+		}
 		http.Redirect(w, r, "/admin", http.StatusFound)
 	case "POST":
 		repo := db.Repo{
-			r.FormValue("name"),
-			r.FormValue("url"),
-			r.FormValue("username"),
-			r.FormValue("password"),
-			encodeSshKey(r.FormValue("ssh_private_key")),
-			r.FormValue("ssh_passphrase"),
+			Name:          r.FormValue("name"),
+			Url:           r.FormValue("url"),
+			Username:      r.FormValue("username"),
+			Password:      r.FormValue("password"),
+			SshPrivateKey: encodeSshKey(r.FormValue("ssh_private_key")),
+			SshPassphrase: r.FormValue("ssh_passphrase"),
+			SigningKeys:   r.FormValue("signing_keys"),
 		}
 		if repo.Name == "" {
 			http.Error(w, "No name provided", http.StatusBadRequest)
@@ -63,6 +74,10 @@ func AdminRepoHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "No url provided", http.StatusBadRequest)
 			return
 		}
+		if err := repository.ValidateSigningKeys(repo.SigningKeys); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if repo.Username != "" {
 			if repo.Password == "" {
 				http.Error(w, "No password provided", http.StatusBadRequest)
@@ -84,3 +99,28 @@ func AdminRepoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
 	}
 }
+
+// AdminSigningKeysHandler replaces the signing keys of a repo without
+// touching its credentials.
+func AdminSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	noCache(w)
+	if r.Method != "POST" {
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := repository.ValidateSigningKeys(r.FormValue("signing_keys")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	db.Repos.Lock()
+	defer db.Repos.Unlock()
+	repo, ok := db.Repos.Get(r.FormValue("name"))
+	if !ok {
+		http.Error(w, "Repo not found", http.StatusNotFound)
+		return
+	}
+	updated := *repo
+	updated.SigningKeys = r.FormValue("signing_keys")
+	db.Repos.Set(updated.Name, &updated)
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
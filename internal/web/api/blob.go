@@ -0,0 +1,67 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"viewre/internal/db"
+	"viewre/internal/languagemapping"
+	"viewre/internal/repository"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func BlobHandler(w http.ResponseWriter, r *http.Request) {
+	repo := r.PathValue("repo")
+	commit := r.PathValue("commit")
+	fileB, err := base64.URLEncoding.DecodeString(r.PathValue("file"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file := string(fileB)
+
+	db.Repos.RLock()
+	dbRepo, ok := db.Repos.Get(repo)
+	db.Repos.RUnlock()
+	if !ok {
+		http.Error(w, "repo not found", http.StatusNotFound)
+		return
+	}
+
+	content, err := repository.ReadBlob(r.Context(), dbRepo, commit, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	contentType, ok := languagemapping.GetImageContentType(file)
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// SVG files can contain scripts, which must not run when the blob is opened directly
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	if plumbing.IsHash(commit) {
+		w.Header().Set("Cache-Control", "private, max-age=2592000") // 30 days
+	} else {
+		noCache(w)
+	}
+	_, _ = w.Write(content)
+}
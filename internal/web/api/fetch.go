@@ -0,0 +1,51 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"viewre/internal/db"
+	"viewre/internal/repository"
+)
+
+// FetchHandler returns the fetch status of a repo on GET and fetches it
+// right away on POST.
+func FetchHandler(w http.ResponseWriter, r *http.Request) {
+	db.Repos.RLock()
+	dbRepo, ok := db.Repos.Get(r.PathValue("repo"))
+	db.Repos.RUnlock()
+	if !ok {
+		http.Error(w, "repo not found", http.StatusNotFound)
+		return
+	}
+
+	noCache(w)
+	switch r.Method {
+	case "GET":
+		JSONResponse(w, repository.GetFetchStatus(dbRepo.Name), http.StatusOK)
+	case "POST":
+		status, err := repository.FetchNow(r.Context(), dbRepo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		JSONResponse(w, status, http.StatusOK)
+	default:
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
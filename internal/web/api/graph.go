@@ -0,0 +1,92 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"viewre/internal/db"
+	"viewre/internal/repository"
+)
+
+func GraphHandler(w http.ResponseWriter, r *http.Request) {
+	db.Repos.RLock()
+	dbRepo, ok := db.Repos.Get(r.PathValue("repo"))
+	db.Repos.RUnlock()
+	if !ok {
+		http.Error(w, "repo not found", http.StatusNotFound)
+		return
+	}
+
+	query, err := parseLogQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := repository.Graph(r.Context(), dbRepo, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	noCache(w)
+	JSONResponse(w, page, http.StatusOK)
+}
+
+// parseLogQuery reads the filters of the log from the query string.
+// Dates are whole days, until is inclusive.
+func parseLogQuery(r *http.Request) (repository.LogQuery, error) {
+	values := r.URL.Query()
+	query := repository.LogQuery{
+		Ref:     values.Get("ref"),
+		Author:  values.Get("author"),
+		Message: values.Get("message"),
+		Path:    values.Get("path"),
+	}
+	if since := values.Get("since"); since != "" {
+		t, err := time.Parse(time.DateOnly, since)
+		if err != nil {
+			return query, err
+		}
+		query.Since = t
+	}
+	if until := values.Get("until"); until != "" {
+		t, err := time.Parse(time.DateOnly, until)
+		if err != nil {
+			return query, err
+		}
+		query.Until = t.AddDate(0, 0, 1)
+	}
+	if offset := values.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid offset %q", offset)
+		}
+		query.Offset = n
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid limit %q", limit)
+		}
+		query.Limit = n
+	}
+	return query, nil
+}
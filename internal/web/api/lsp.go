@@ -26,22 +26,29 @@ import (
 	"viewre/internal/db"
 	"viewre/internal/languagemapping"
 	"viewre/internal/lsp"
+	"viewre/internal/markdown"
 	"viewre/internal/repository"
+)
 
-	"github.com/gomarkdown/markdown"
-	gomdhtml "github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
+// lspMutexes serialize the requests to the language servers of a checkout,
+// which answer one request at a time.
+var (
+	lspMutexes      = make(map[string]*sync.Mutex)
+	lspMutexesMutex = &sync.Mutex{}
 )
 
-var lspApiMutex = &sync.Mutex{}
+func lspMutex(projectDir string) *sync.Mutex {
+	lspMutexesMutex.Lock()
+	defer lspMutexesMutex.Unlock()
+	mutex, ok := lspMutexes[projectDir]
+	if !ok {
+		mutex = &sync.Mutex{}
+		lspMutexes[projectDir] = mutex
+	}
+	return mutex
+}
 
 func LspHoverHandler(w http.ResponseWriter, r *http.Request) {
-	lspApiMutex.Lock()
-	defer lspApiMutex.Unlock()
-
-	db.Repos.RLock()
-	defer db.Repos.RUnlock()
-
 	repo := r.PathValue("repo")
 	commit := r.PathValue("commit")
 	fileB64 := r.PathValue("file")
@@ -58,7 +65,9 @@ func LspHoverHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db.Repos.RLock()
 	dbRepo, ok := db.Repos.Get(repo)
+	db.Repos.RUnlock()
 	if !ok {
 		http.Error(w, "repo not found", http.StatusNotFound)
 		return
@@ -70,6 +79,9 @@ func LspHoverHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	mutex := lspMutex(projectDir)
+	mutex.Lock()
+	defer mutex.Unlock()
 	client, err := lsp.GetServer(
 		languagemapping.GetLanguageID(filepath.Base(file)),
 		projectDir,
@@ -86,25 +98,11 @@ func LspHoverHandler(w http.ResponseWriter, r *http.Request) {
 	var hoverHtml []byte
 	switch hover.ContentType {
 	case "markdown":
-		hoverHtml = mdToHTML([]byte(hover.Content))
+		hoverHtml = markdown.ToHTML([]byte(hover.Content))
 	case "plaintext":
 		hoverHtml = []byte(html.EscapeString(hover.Content))
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Cache-Control", "private, max-age=300")
 	_, _ = w.Write(hoverHtml)
 }
-
-func mdToHTML(md []byte) []byte {
-	// create markdown parser with extensions
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
-	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(md)
-
-	// create HTML renderer with extensions
-	htmlFlags := gomdhtml.CommonFlags | gomdhtml.HrefTargetBlank
-	opts := gomdhtml.RendererOptions{Flags: htmlFlags}
-	renderer := gomdhtml.NewRenderer(opts)
-
-	return markdown.Render(doc, renderer)
-}
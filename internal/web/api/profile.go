@@ -0,0 +1,58 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"viewre/internal/db"
+	"viewre/internal/theme"
+)
+
+func ProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	noCache(w)
+	if r.Method != "POST" {
+		http.Error(w, fmt.Sprintf("Method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _ := r.Context().Value("id").(string)
+	if userID == "" {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	themeID := r.FormValue("theme")
+	if !theme.Exists(themeID) {
+		http.Error(w, fmt.Sprintf("Unknown theme %q", themeID), http.StatusBadRequest)
+		return
+	}
+	renameThreshold, err := strconv.Atoi(r.FormValue("rename_threshold"))
+	if err != nil || renameThreshold < 0 || renameThreshold > 100 {
+		http.Error(w, "Rename threshold must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	db.UserSettings.Lock()
+	defer db.UserSettings.Unlock()
+	setting, ok := db.UserSettings.Get(userID)
+	if !ok {
+		setting = &db.UserSetting{}
+	}
+	setting.Theme = themeID
+	setting.RenameThreshold = &renameThreshold
+	db.UserSettings.Set(userID, setting)
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
@@ -0,0 +1,42 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"net/http"
+	"viewre/internal/db"
+	"viewre/internal/repository"
+)
+
+func RefsHandler(w http.ResponseWriter, r *http.Request) {
+	db.Repos.RLock()
+	dbRepo, ok := db.Repos.Get(r.PathValue("repo"))
+	db.Repos.RUnlock()
+	if !ok {
+		http.Error(w, "repo not found", http.StatusNotFound)
+		return
+	}
+
+	refs, err := repository.Refs(r.Context(), dbRepo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	noCache(w)
+	JSONResponse(w, refs, http.StatusOK)
+}
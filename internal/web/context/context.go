@@ -22,7 +22,11 @@ import (
 	"fmt"
 	"html"
 	"net/http"
+	"strconv"
 	"time"
+	"viewre/internal/db"
+	"viewre/internal/repository"
+	"viewre/internal/theme"
 	"viewre/internal/web/api"
 
 	"github.com/workos/workos-go/v4/pkg/usermanagement"
@@ -88,6 +92,47 @@ func (ctx MyContext) Value(key any) any {
 			return ctx.user.EmailVerified
 		case "logged_in":
 			return ctx.LoggedIn
+		case "theme":
+			return userTheme(ctx)
+		case "rename_threshold":
+			return renameThreshold(ctx)
+		case "file":
+			// file paths are base64url encoded to fit in one path segment
+			if file, err := base64.URLEncoding.DecodeString(ctx.request.PathValue(keyStr)); err == nil {
+				return string(file)
+			}
+			return ""
+		case "path":
+			// empty for the root directory of the tree page
+			return ctx.request.PathValue(keyStr)
+		case "parent":
+			// the commit page diffs against this parent, counting from 1 like git's rev^n
+			if parent, err := strconv.Atoi(ctx.request.URL.Query().Get(keyStr)); err == nil && parent > 0 {
+				return parent
+			}
+			return 1
+		case "offset":
+			// the row of the history a paged list continues at
+			if offset, err := strconv.Atoi(ctx.request.URL.Query().Get(keyStr)); err == nil && offset > 0 {
+				return offset
+			}
+			return 0
+		case "paths":
+			// restricts the compare page to some files, e.g. from the file history
+			var paths []string
+			for _, p := range ctx.request.URL.Query()["paths"] {
+				if p != "" {
+					paths = append(paths, p)
+				}
+			}
+			return paths
+		case "ignore_all_space", "ignore_space_change", "ignore_blank_lines", "force", "blame":
+			switch ctx.request.URL.Query().Get(keyStr) {
+			case "", "0", "false", "off":
+				return false
+			default:
+				return true
+			}
 		default:
 			val := ctx.request.PathValue(keyStr)
 			if val != "" {
@@ -99,6 +144,34 @@ func (ctx MyContext) Value(key any) any {
 	return ctx.ctx.Value(key)
 }
 
+func userTheme(ctx MyContext) string {
+	if ctx.LoggedIn {
+		db.UserSettings.RLock()
+		defer db.UserSettings.RUnlock()
+		if setting, ok := db.UserSettings.Get(ctx.user.ID); ok && theme.Exists(setting.Theme) {
+			return setting.Theme
+		}
+	}
+	return theme.Themes[0].ID
+}
+
+// renameThreshold is the similarity for rename detection from the profile,
+// which can be overridden per page with ?similarity=N. 0 turns rename
+// detection off.
+func renameThreshold(ctx MyContext) int {
+	if similarity, err := strconv.Atoi(ctx.request.URL.Query().Get("similarity")); err == nil && similarity >= 0 && similarity <= 100 {
+		return similarity
+	}
+	if ctx.LoggedIn {
+		db.UserSettings.RLock()
+		defer db.UserSettings.RUnlock()
+		if setting, ok := db.UserSettings.Get(ctx.user.ID); ok && setting.RenameThreshold != nil {
+			return *setting.RenameThreshold
+		}
+	}
+	return repository.DefaultRenameThreshold
+}
+
 func initials(user *usermanagement.User) string {
 	if len(user.FirstName) > 0 {
 		if len(user.LastName) > 0 {
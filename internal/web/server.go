@@ -32,7 +32,15 @@ func NewServer() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/_static/", view.StaticFileHandler)
 	mux.HandleFunc("/", IndexTemplHandler(view.Index()))
+	mux.HandleFunc("/repos/{repo}/tree/{rev}", RequireActiveLogin(TemplHandler(view.Tree())))
+	mux.HandleFunc("/repos/{repo}/tree/{rev}/{path...}", RequireActiveLogin(TemplHandler(view.Tree())))
+	mux.HandleFunc("/repos/{repo}/blob/{rev}/{path...}", RequireActiveLogin(TemplHandler(view.Blob())))
+	mux.HandleFunc("/repos/{repo}/blame/{rev}/{path...}", RequireActiveLogin(TemplHandler(view.BlameFile())))
+	mux.HandleFunc("/repos/{repo}/history/{rev}/{path...}", RequireActiveLogin(TemplHandler(view.History())))
+	mux.HandleFunc("/repos/{repo}/commit/{hash}", RequireActiveLogin(TemplHandler(view.CommitPage())))
 	mux.HandleFunc("/compare/{repo}/{a}/{b}", RequireActiveLogin(CaheFor(2*time.Minute, TemplHandler(view.Compare()))))
+	mux.HandleFunc("/compare/{repo}/{a}/{b}/file/{file}", RequireActiveLogin(CaheFor(2*time.Minute, TemplHandler(view.CompareFile()))))
+	mux.HandleFunc("/compare/{repo}/{a}/{b}/symbols", RequireActiveLogin(CaheFor(2*time.Minute, TemplHandler(view.CompareSymbols()))))
 	mux.HandleFunc("/repos/{repo}", RequireActiveLogin(CaheFor(2*time.Minute, TemplHandler(view.Repo()))))
 	mux.HandleFunc("/profile", RequireLogin(TemplHandler(view.Profile())))
 	mux.HandleFunc("/admin", RequireActiveLogin(TemplHandler(view.Admin())))
@@ -40,20 +48,28 @@ func NewServer() http.Handler {
 	mux.HandleFunc("/api/login_callback", api.LoginCallbackHandler)
 	mux.HandleFunc("/api/logout", RequireActiveLogin(api.LogoutHandler))
 	mux.HandleFunc("/api/repo", RequireActiveLogin(api.AdminRepoHandler))
+	mux.HandleFunc("/api/repo/signing_keys", RequireActiveLogin(api.AdminSigningKeysHandler))
+	mux.HandleFunc("/api/profile/settings", RequireLogin(api.ProfileSettingsHandler))
+	mux.HandleFunc("/api/blob/{repo}/{commit}/{file}", RequireActiveLogin(api.BlobHandler))
+	mux.HandleFunc("/api/graph/{repo}", RequireActiveLogin(api.GraphHandler))
+	mux.HandleFunc("/api/refs/{repo}", RequireActiveLogin(api.RefsHandler))
+	mux.HandleFunc("/api/fetch/{repo}", RequireActiveLogin(api.FetchHandler))
 	mux.HandleFunc("/api/lsp/hover/{repo}/{commit}/{file}/{index}", api.LspHoverHandler)
 	return mux
 }
 
+// CaheFor lets the browser reuse a page for the given duration. Pages contain
+// the user's theme and picture, so shared caches must not store them.
 func CaheFor(duration time.Duration, next http.HandlerFunc) http.HandlerFunc {
 	if config.Production {
 		maxAge := int(duration.Seconds())
 		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+			w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
 			next(w, r)
 		}
 	} else {
 		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Cache-Control", "public, max-age=10")
+			w.Header().Set("Cache-Control", "private, max-age=10")
 			next(w, r)
 		}
 	}
@@ -174,3 +174,390 @@ async function getSymbolHover(el: HTMLElement) {
 function base64UrlEncode(str: string) {
   return btoa(str).replace(/\+/g, "-").replace(/\//g, "_");
 }
+
+function registerModeSwitch(block: string, modes: string[]) {
+  mainEl.addEventListener("click", (event) => {
+    const buttonEl = (event.target as HTMLElement | null)?.closest<HTMLElement>(
+      `.${block}__mode`,
+    );
+    if (!buttonEl) {
+      return;
+    }
+    const blockEl = buttonEl.closest(`.${block}`);
+    if (!blockEl) {
+      return;
+    }
+    const mode = buttonEl.dataset.mode;
+    for (const m of modes) {
+      blockEl.classList.toggle(`${block}--${m}`, m === mode);
+    }
+    for (const el of blockEl.querySelectorAll(`.${block}__mode`)) {
+      el.classList.toggle(`${block}__mode--active`, el === buttonEl);
+    }
+  });
+}
+
+registerModeSwitch("image-diff", ["side", "swipe", "onion"]);
+registerModeSwitch("file-view", ["source", "rendered"]);
+
+mainEl.addEventListener("input", (event) => {
+  const sliderEl = event.target as HTMLInputElement | null;
+  if (!sliderEl || !sliderEl.classList.contains("image-diff__slider")) {
+    return;
+  }
+  const imageDiffEl = sliderEl.closest<HTMLElement>(".image-diff");
+  if (!imageDiffEl) {
+    return;
+  }
+  imageDiffEl.style.setProperty("--image-diff-position", `${sliderEl.value}%`);
+});
+
+// file bodies are rendered on demand, when they are opened or scrolled into view
+
+// data-force and data-blame survive reloads of the body, so that toggling
+// blame keeps a large file loaded and the other way around
+async function loadFileBody(bodyEl: HTMLElement) {
+  const src = bodyEl.dataset.src;
+  if (!src || bodyEl.dataset.loaded) {
+    return;
+  }
+  bodyEl.dataset.loaded = "loading";
+  const params = new URLSearchParams(window.location.search);
+  if (bodyEl.dataset.force) {
+    params.set("force", "1");
+  }
+  if (bodyEl.dataset.blame) {
+    params.set("blame", "1");
+  }
+  try {
+    const response = await fetch(`${src}?${params}`);
+    bodyEl.innerHTML = await response.text();
+    bodyEl.dataset.loaded = "true";
+    scheduleDiffScopesUpdate();
+  } catch (error) {
+    console.error(error);
+    bodyEl.innerText = "Failed to load file";
+    delete bodyEl.dataset.loaded;
+  }
+}
+
+const fileBodyObserver = new IntersectionObserver(
+  (entries) => {
+    for (const entry of entries) {
+      if (!entry.isIntersecting) {
+        continue;
+      }
+      const bodyEl = entry.target as HTMLElement;
+      fileBodyObserver.unobserve(bodyEl);
+      loadFileBody(bodyEl);
+    }
+  },
+  { rootMargin: "1000px 0px" },
+);
+
+for (const bodyEl of document.querySelectorAll<HTMLElement>(".file-body")) {
+  fileBodyObserver.observe(bodyEl);
+}
+
+// toggle events don't bubble
+mainEl.addEventListener(
+  "toggle",
+  (event) => {
+    const detailsEl = event.target as HTMLDetailsElement | null;
+    if (!detailsEl || !detailsEl.open) {
+      return;
+    }
+    const bodyEl = detailsEl.querySelector<HTMLElement>(":scope > .file-body");
+    if (bodyEl) {
+      loadFileBody(bodyEl);
+    }
+  },
+  true,
+);
+
+function reloadFileBody(bodyEl: HTMLElement) {
+  delete bodyEl.dataset.loaded;
+  bodyEl.innerHTML = `<p class="text-stone-400">Loading…</p>`;
+  loadFileBody(bodyEl);
+}
+
+mainEl.addEventListener("click", (event) => {
+  const buttonEl = (event.target as HTMLElement | null)?.closest(
+    ".file-body__force",
+  );
+  const bodyEl = buttonEl?.closest<HTMLElement>(".file-body");
+  if (!bodyEl) {
+    return;
+  }
+  bodyEl.dataset.force = "1";
+  reloadFileBody(bodyEl);
+});
+
+mainEl.addEventListener("click", (event) => {
+  const buttonEl = (event.target as HTMLElement | null)?.closest(
+    ".file-body__blame",
+  );
+  const bodyEl = buttonEl?.closest<HTMLElement>(".file-body");
+  if (!bodyEl) {
+    return;
+  }
+  if (bodyEl.dataset.blame) {
+    delete bodyEl.dataset.blame;
+  } else {
+    bodyEl.dataset.blame = "1";
+  }
+  reloadFileBody(bodyEl);
+});
+
+// the changed symbols parse every file, so they are loaded after the file list
+
+async function loadSymbols(overviewEl: HTMLElement, src: string) {
+  try {
+    const response = await fetch(`${src}${window.location.search}`);
+    const templateEl = document.createElement("template");
+    templateEl.innerHTML = await response.text();
+    for (const symbolsEl of templateEl.content.querySelectorAll<HTMLElement>(
+      ".file-symbols",
+    )) {
+      symbolsEl.remove();
+      const headerEl = mainEl.querySelector<HTMLElement>(
+        `.file-symbols[data-file="${CSS.escape(symbolsEl.dataset.file ?? "")}"]`,
+      );
+      headerEl?.replaceChildren(...symbolsEl.childNodes);
+    }
+    overviewEl.replaceChildren(templateEl.content);
+  } catch (error) {
+    console.error(error);
+  }
+}
+
+const symbolsOverviewEl = document.getElementById("symbols-overview");
+if (symbolsOverviewEl?.dataset.src) {
+  loadSymbols(symbolsOverviewEl, symbolsOverviewEl.dataset.src);
+}
+
+// file tree
+
+const fileTreeFilterEl = document.querySelector<HTMLInputElement>(
+  ".file-tree__filter",
+);
+
+// globMatcher matches paths against a glob like src/**/*.go. A plain
+// extension like .go matches all files with it and any other text matches
+// paths that contain it.
+function globMatcher(pattern: string): (path: string) => boolean {
+  pattern = pattern.trim();
+  if (pattern === "") {
+    return () => true;
+  }
+  if (/^\.[^/*?]+$/.test(pattern)) {
+    return (path) => path.endsWith(pattern);
+  }
+  if (!/[*?]/.test(pattern)) {
+    return (path) => path.includes(pattern);
+  }
+  let source = "";
+  for (let i = 0; i < pattern.length; i++) {
+    const c = pattern[i]!;
+    if (c === "*" && pattern[i + 1] === "*") {
+      source += ".*";
+      i++;
+      if (pattern[i + 1] === "/") {
+        // **/ also matches no directory at all
+        source = source.slice(0, -2) + "(?:.*/)?";
+        i++;
+      }
+    } else if (c === "*") {
+      source += "[^/]*";
+    } else if (c === "?") {
+      source += "[^/]";
+    } else {
+      source += c.replace(/[.+^${}()|[\]\\]/g, "\\$&");
+    }
+  }
+  // patterns without a slash match the file name in any directory
+  const regex = new RegExp(
+    pattern.includes("/") ? `^${source}$` : `(?:^|/)${source}$`,
+  );
+  return (path) => regex.test(path);
+}
+
+fileTreeFilterEl?.addEventListener("input", () => {
+  const matches = globMatcher(fileTreeFilterEl.value);
+  for (const fileEl of document.querySelectorAll<HTMLElement>(
+    ".file-tree__file",
+  )) {
+    const visible = matches(fileEl.dataset.path ?? "");
+    fileEl.hidden = !visible;
+    const anchor = fileEl.querySelector("a")?.hash.slice(1);
+    const detailsEl = anchor ? document.getElementById(anchor) : null;
+    if (detailsEl) {
+      detailsEl.hidden = !visible;
+    }
+  }
+  // hide directories without visible files, the deepest ones first
+  const dirEls = Array.from(
+    document.querySelectorAll<HTMLElement>(".file-tree__dir"),
+  ).reverse();
+  for (const dirEl of dirEls) {
+    dirEl.hidden = !dirEl.querySelector(".file-tree__file:not([hidden])");
+  }
+});
+
+mainEl.addEventListener("click", (event) => {
+  const linkEl = (event.target as HTMLElement | null)?.closest<HTMLAnchorElement>(
+    ".file-tree__file > a",
+  );
+  if (!linkEl) {
+    return;
+  }
+  const detailsEl = document.getElementById(linkEl.hash.slice(1));
+  if (detailsEl instanceof HTMLDetailsElement) {
+    detailsEl.open = true;
+  }
+});
+
+// sticky breadcrumb of the definition the top line of each side is in
+
+interface ScopeMarker {
+  // distance from the top of the code element
+  offset: number;
+  scope: string;
+}
+
+// the markers of each side in document order, measured once per layout
+let scopeMarkers = new WeakMap<HTMLElement, ScopeMarker[]>();
+
+function sideScopeMarkers(codeEl: HTMLElement): ScopeMarker[] {
+  let markers = scopeMarkers.get(codeEl);
+  if (markers) {
+    return markers;
+  }
+  markers = [];
+  const codeTop = codeEl.getBoundingClientRect().top;
+  for (const markerEl of codeEl.querySelectorAll<HTMLElement>(
+    ".scope-marker",
+  )) {
+    if (!markerEl.offsetParent) {
+      // inside of folded lines
+      continue;
+    }
+    markers.push({
+      offset: markerEl.getBoundingClientRect().top - codeTop,
+      scope: markerEl.dataset.scope ?? "",
+    });
+  }
+  scopeMarkers.set(codeEl, markers);
+  return markers;
+}
+
+// scopeAt returns the scope of the last marker at or above offset.
+function scopeAt(markers: ScopeMarker[], offset: number): string {
+  let low = 0;
+  let high = markers.length;
+  while (low < high) {
+    const mid = (low + high) >> 1;
+    if ((markers[mid]?.offset ?? 0) <= offset) {
+      low = mid + 1;
+    } else {
+      high = mid;
+    }
+  }
+  return markers[low - 1]?.scope ?? "";
+}
+
+function updateDiffScopes() {
+  for (const diffEl of document.querySelectorAll<HTMLElement>(".diff")) {
+    const rect = diffEl.getBoundingClientRect();
+    if (rect.height === 0 || rect.bottom < 0 || rect.top > window.innerHeight) {
+      continue;
+    }
+    const summaryEl = diffEl.closest("details")?.querySelector("summary");
+    const top = summaryEl?.getBoundingClientRect().height ?? 0;
+    for (const side of ["left", "right"]) {
+      const scopeEl = diffEl.querySelector<HTMLElement>(
+        `:scope > .diff__scope--${side}`,
+      );
+      const codeEl = diffEl.querySelector<HTMLElement>(
+        `:scope > .diff__${side}`,
+      );
+      if (!scopeEl || !codeEl) {
+        continue;
+      }
+      scopeEl.style.top = `${top}px`;
+      const line =
+        scopeEl.getBoundingClientRect().bottom -
+        codeEl.getBoundingClientRect().top;
+      const scope = scopeAt(sideScopeMarkers(codeEl), line);
+      scopeEl.textContent = scope;
+      scopeEl.title = scope;
+    }
+  }
+}
+
+let diffScopesFrame = 0;
+
+function scheduleDiffScopesUpdate() {
+  if (diffScopesFrame) {
+    return;
+  }
+  diffScopesFrame = requestAnimationFrame(() => {
+    diffScopesFrame = 0;
+    updateDiffScopes();
+  });
+}
+
+document.addEventListener("scroll", scheduleDiffScopesUpdate, {
+  passive: true,
+});
+window.addEventListener("resize", () => {
+  // lines wrap differently now
+  scopeMarkers = new WeakMap();
+  scheduleDiffScopesUpdate();
+});
+
+// folding a block folds the block with the same key on the other side too
+
+mainEl.addEventListener("click", (event) => {
+  const toggleEl = (event.target as HTMLElement | null)?.closest<HTMLElement>(
+    ".fold-toggle",
+  );
+  const diffEl = toggleEl?.closest(".diff");
+  if (!toggleEl || !diffEl) {
+    return;
+  }
+  const key = toggleEl.dataset.foldKey ?? "";
+  const folded = !toggleEl.classList.contains("fold-toggle--folded");
+  for (const sideEl of diffEl.querySelectorAll<HTMLElement>(
+    ":scope > .diff__left, :scope > .diff__right",
+  )) {
+    const sideToggleEl = sideEl.contains(toggleEl)
+      ? toggleEl
+      : sideEl.querySelector<HTMLElement>(
+          `.fold-toggle[data-fold-key="${CSS.escape(key)}"]`,
+        );
+    if (
+      sideToggleEl &&
+      sideToggleEl.classList.contains("fold-toggle--folded") !== folded
+    ) {
+      setFolded(sideEl, sideToggleEl, folded);
+    }
+    scopeMarkers.delete(sideEl);
+  }
+  scheduleDiffScopesUpdate();
+});
+
+function setFolded(sideEl: HTMLElement, toggleEl: HTMLElement, folded: boolean) {
+  const start = parseInt(toggleEl.dataset.foldStart ?? "");
+  const end = parseInt(toggleEl.dataset.foldEnd ?? "");
+  // lines can be in more than one folded block, so the folds are counted
+  for (const lineEl of sideEl.querySelectorAll<HTMLElement>(".line")) {
+    const line = parseInt(lineEl.dataset.line ?? "");
+    if (line < start || line > end) {
+      continue;
+    }
+    const folds = parseInt(lineEl.dataset.folds ?? "0") + (folded ? 1 : -1);
+    lineEl.dataset.folds = String(Math.max(folds, 0));
+  }
+  toggleEl.classList.toggle("fold-toggle--folded", folded);
+}
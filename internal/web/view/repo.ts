@@ -0,0 +1,382 @@
+// ViewRe is a web-based code review tool.
+// Copyright (C) 2025  Frank Mayer
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+type GraphEdge = {
+  from: number;
+  to: number;
+};
+
+type GraphCommit = {
+  hash: string;
+  parents: string[];
+  refs: string[] | null;
+  author: string;
+  author_email: string;
+  date: string;
+  subject: string;
+  lane: number;
+  edges: GraphEdge[] | null;
+};
+
+type Ref = {
+  name: string;
+  tag: boolean;
+  default: boolean;
+  hash: string;
+  subject: string;
+  author: string;
+  date: string;
+  ahead: number;
+  behind: number;
+};
+
+type LogPage = {
+  commits: GraphCommit[];
+  next?: number;
+};
+
+const rowHeight = 24;
+const laneWidth = 14;
+const laneColors = [
+  "#eab308",
+  "#3b82f6",
+  "#22c55e",
+  "#ef4444",
+  "#a855f7",
+  "#06b6d4",
+  "#f97316",
+  "#ec4899",
+];
+const svgNs = "http://www.w3.org/2000/svg";
+const filterKeys = ["ref", "author", "message", "path", "since", "until"];
+
+const graphEl = document.getElementById("commit-graph");
+const statusEl = document.getElementById("commit-graph-status");
+const filterEl = document.getElementById("log-filter") as HTMLFormElement | null;
+
+// CommitGraph renders the rows of the log and the lanes next to them.
+// Pages are appended as they are loaded.
+class CommitGraph {
+  private svgEl: SVGSVGElement;
+  private rowsEl: HTMLDivElement;
+  private lanes = 1;
+  private repo: string;
+  length = 0;
+
+  constructor(graphEl: HTMLElement) {
+    this.repo = graphEl.dataset.repo ?? "";
+    this.svgEl = document.createElementNS(svgNs, "svg");
+    this.svgEl.classList.add("commit-graph__lanes");
+    this.rowsEl = document.createElement("div");
+    graphEl.replaceChildren(this.svgEl, this.rowsEl);
+    this.resize();
+  }
+
+  append(commits: GraphCommit[]) {
+    for (const commit of commits) {
+      this.lanes = Math.max(this.lanes, commit.lane + 1);
+      for (const edge of commit.edges ?? []) {
+        this.lanes = Math.max(this.lanes, edge.from + 1, edge.to + 1);
+      }
+      this.drawCommit(commit, this.length);
+      this.rowsEl.appendChild(renderRow(commit, this.repo));
+      this.length++;
+    }
+    this.resize();
+  }
+
+  private resize() {
+    const width = this.lanes * laneWidth;
+    this.svgEl.setAttribute("width", String(width));
+    // edges of the last row lead into the next page
+    this.svgEl.setAttribute("height", String((this.length + 1) * rowHeight));
+    this.rowsEl.style.paddingLeft = `${width + 8}px`;
+  }
+
+  private drawCommit(commit: GraphCommit, row: number) {
+    for (const edge of commit.edges ?? []) {
+      const pathEl = document.createElementNS(svgNs, "path");
+      const x1 = laneX(edge.from);
+      const x2 = laneX(edge.to);
+      const y1 = rowY(row);
+      const y2 = rowY(row + 1);
+      const yMid = (y1 + y2) / 2;
+      pathEl.setAttribute(
+        "d",
+        x1 === x2
+          ? `M ${x1} ${y1} L ${x2} ${y2}`
+          : `M ${x1} ${y1} C ${x1} ${yMid}, ${x2} ${yMid}, ${x2} ${y2}`,
+      );
+      pathEl.setAttribute("stroke", laneColor(edge.from === commit.lane ? edge.to : edge.from));
+      pathEl.setAttribute("stroke-width", "2");
+      pathEl.setAttribute("fill", "none");
+      this.svgEl.appendChild(pathEl);
+    }
+
+    const circleEl = document.createElementNS(svgNs, "circle");
+    circleEl.setAttribute("cx", String(laneX(commit.lane)));
+    circleEl.setAttribute("cy", String(rowY(row)));
+    circleEl.setAttribute("r", commit.parents.length > 1 ? "3" : "4");
+    circleEl.setAttribute("fill", laneColor(commit.lane));
+    this.svgEl.appendChild(circleEl);
+  }
+}
+
+async function loadRefs(refsEl: HTMLElement, src: string, repo: string) {
+  const response = await fetch(src);
+  const statusEl = refsEl.querySelector(".refs__status") as HTMLElement;
+  if (!response.ok) {
+    statusEl.innerText = await response.text();
+    return;
+  }
+  const refs: Ref[] = await response.json();
+  if (refs.length === 0) {
+    statusEl.innerText = "No branches or tags";
+    return;
+  }
+  statusEl.remove();
+  const defaultRef = refs.find((ref) => ref.default);
+
+  const tableEl = document.createElement("table");
+  tableEl.classList.add("refs__table");
+  for (const ref of refs) {
+    const rowEl = tableEl.insertRow();
+
+    const nameEl = document.createElement("span");
+    nameEl.classList.add("commit-graph__ref");
+    if (ref.tag) {
+      nameEl.classList.add("commit-graph__ref--tag");
+    }
+    nameEl.innerText = ref.name;
+    rowEl.insertCell().appendChild(nameEl);
+
+    const subjectCell = rowEl.insertCell();
+    subjectCell.classList.add("refs__subject");
+    subjectCell.innerText = ref.subject;
+    subjectCell.title = `${ref.hash.slice(0, 8)} by ${ref.author}`;
+
+    const dateCell = rowEl.insertCell();
+    dateCell.classList.add("refs__meta");
+    dateCell.innerText = new Date(ref.date).toLocaleDateString();
+
+    const divergenceCell = rowEl.insertCell();
+    divergenceCell.classList.add("refs__meta");
+    if (defaultRef && !ref.default) {
+      divergenceCell.innerText = `${ref.ahead} ahead, ${ref.behind} behind`;
+      divergenceCell.title = `compared to ${defaultRef.name}`;
+    }
+
+    const actionsCell = rowEl.insertCell();
+    actionsCell.classList.add("refs__actions");
+    const browseEl = document.createElement("a");
+    browseEl.classList.add("refs__action");
+    browseEl.href = `/repos/${encodeURIComponent(repo)}/tree/${encodeURIComponent(ref.name)}`;
+    browseEl.innerText = "Browse";
+    actionsCell.appendChild(browseEl);
+    for (const [label, inputId] of [
+      ["Base", "base_commit"],
+      ["Change", "change_commit"],
+    ] as const) {
+      const buttonEl = document.createElement("button");
+      buttonEl.type = "button";
+      buttonEl.classList.add("refs__action");
+      buttonEl.innerText = label;
+      buttonEl.addEventListener("click", () => {
+        const inputEl = document.getElementById(inputId) as HTMLInputElement | null;
+        if (inputEl) {
+          inputEl.value = ref.name;
+        }
+      });
+      actionsCell.appendChild(buttonEl);
+    }
+    if (defaultRef && !ref.default) {
+      const compareEl = document.createElement("a");
+      compareEl.classList.add("refs__action");
+      compareEl.href = `/compare/${encodeURIComponent(repo)}/${encodeURIComponent(defaultRef.name)}/${encodeURIComponent(ref.name)}`;
+      compareEl.innerText = `Compare with ${defaultRef.name}`;
+      actionsCell.appendChild(compareEl);
+    }
+  }
+  refsEl.appendChild(tableEl);
+}
+
+function laneX(lane: number) {
+  return lane * laneWidth + laneWidth / 2;
+}
+
+function rowY(row: number) {
+  return row * rowHeight + rowHeight / 2;
+}
+
+function laneColor(lane: number) {
+  return laneColors[lane % laneColors.length]!;
+}
+
+function renderRow(commit: GraphCommit, repo: string) {
+  const rowEl = document.createElement("div");
+  rowEl.classList.add("commit-graph__row");
+  rowEl.style.height = `${rowHeight}px`;
+  rowEl.dataset.commit = commit.hash;
+
+  const hashEl = document.createElement("a");
+  hashEl.classList.add("commit-graph__hash");
+  hashEl.href = `/repos/${encodeURIComponent(repo)}/commit/${commit.hash}`;
+  hashEl.innerText = commit.hash.slice(0, 8);
+  // clicking the row selects the commit for the comparison instead
+  hashEl.addEventListener("click", (event) => event.stopPropagation());
+  rowEl.appendChild(hashEl);
+
+  for (const ref of commit.refs ?? []) {
+    const refEl = document.createElement("span");
+    refEl.classList.add("commit-graph__ref");
+    if (ref.startsWith("tag: ")) {
+      refEl.classList.add("commit-graph__ref--tag");
+    }
+    refEl.innerText = ref;
+    rowEl.appendChild(refEl);
+  }
+
+  const subjectEl = document.createElement("span");
+  subjectEl.classList.add("commit-graph__subject");
+  subjectEl.innerText = commit.subject;
+  rowEl.appendChild(subjectEl);
+
+  const metaEl = document.createElement("span");
+  metaEl.classList.add("commit-graph__meta");
+  metaEl.innerText = `${commit.author}, ${new Date(commit.date).toLocaleString()}`;
+  metaEl.title = commit.author_email;
+  rowEl.appendChild(metaEl);
+
+  return rowEl;
+}
+
+if (graphEl?.dataset.src && statusEl && filterEl) {
+  const src = graphEl.dataset.src;
+  let graph = new CommitGraph(graphEl);
+  let filters = new URLSearchParams();
+  let next: number | undefined = 0;
+  let loading = false;
+  // incremented on every filter change, so that responses for old filters are dropped
+  let generation = 0;
+
+  const observer = new IntersectionObserver(
+    (entries) => {
+      if (entries.some((entry) => entry.isIntersecting)) {
+        loadPage();
+      }
+    },
+    { rootMargin: "1000px" },
+  );
+
+  async function loadPage() {
+    if (loading || next === undefined) {
+      return;
+    }
+    loading = true;
+    const current = generation;
+    const params = new URLSearchParams(filters);
+    params.set("offset", String(next));
+    statusEl!.innerText = "Loading history…";
+    try {
+      const response = await fetch(`${src}?${params}`);
+      if (current !== generation) {
+        return;
+      }
+      if (!response.ok) {
+        statusEl!.innerText = await response.text();
+        next = undefined;
+        return;
+      }
+      const page: LogPage = await response.json();
+      if (current !== generation) {
+        return;
+      }
+      graph.append(page.commits);
+      next = page.next;
+      statusEl!.innerText =
+        next !== undefined ? "" : graph.length === 0 ? "No commits found" : "End of history";
+    } finally {
+      if (current === generation) {
+        loading = false;
+        // observe again, so that a sentinel that is still visible triggers the next page
+        observer.unobserve(statusEl!);
+        observer.observe(statusEl!);
+      }
+    }
+  }
+
+  function applyFilters() {
+    filters = new URLSearchParams();
+    const data = new FormData(filterEl!);
+    for (const key of filterKeys) {
+      const value = data.get(key);
+      if (typeof value === "string" && value !== "") {
+        filters.set(key, value);
+      }
+    }
+    const url = new URL(location.href);
+    url.search = filters.toString();
+    history.replaceState(null, "", url);
+
+    generation++;
+    loading = false;
+    next = 0;
+    graph = new CommitGraph(graphEl!);
+    return loadPage();
+  }
+
+  const initial = new URLSearchParams(location.search);
+  for (const key of filterKeys) {
+    const inputEl = filterEl.elements.namedItem(key);
+    if (inputEl instanceof HTMLInputElement) {
+      inputEl.value = initial.get(key) ?? "";
+    }
+  }
+  filterEl.addEventListener("submit", (event) => {
+    event.preventDefault();
+    applyFilters();
+  });
+  const refsEl = document.getElementById("refs");
+  applyFilters().then(() => {
+    // the first page of the log fetches the refs
+    if (refsEl?.dataset.src && refsEl.dataset.repo) {
+      loadRefs(refsEl, refsEl.dataset.src, refsEl.dataset.repo);
+    }
+  });
+  observer.observe(statusEl);
+}
+
+const fetchStatusEl = document.getElementById("fetch-status");
+const fetchButtonEl = fetchStatusEl?.querySelector(".fetch-status__button") as HTMLButtonElement | null;
+if (fetchStatusEl?.dataset.src && fetchButtonEl) {
+  const src = fetchStatusEl.dataset.src;
+  fetchButtonEl.addEventListener("click", async () => {
+    fetchButtonEl.disabled = true;
+    fetchButtonEl.innerText = "Fetching…";
+    const response = await fetch(src, { method: "POST" });
+    if (response.ok) {
+      location.reload();
+      return;
+    }
+    const errorEl = document.createElement("span");
+    errorEl.classList.add("fetch-status__error");
+    errorEl.innerText = `Fetch failed: ${await response.text()}`;
+    fetchStatusEl.querySelector(".fetch-status__error")?.remove();
+    fetchStatusEl.insertBefore(errorEl, fetchButtonEl);
+    fetchButtonEl.disabled = false;
+    fetchButtonEl.innerText = "Fetch now";
+  });
+}
@@ -25,9 +25,11 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	unixpath "path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/a-h/templ"
 )
@@ -133,3 +135,96 @@ func staticUrl(path string) string {
 func fmtUrl(format string, args ...any) templ.SafeURL {
 	return templ.URL(fmt.Sprintf(format, args...))
 }
+
+func fmtSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func fmtSizeChange(fromSize, toSize int64) string {
+	change := toSize - fromSize
+	sign := "+"
+	if change < 0 {
+		sign = "-"
+		change = -change
+	}
+	return fmt.Sprintf("%s → %s (%s%s)", fmtSize(fromSize), fmtSize(toSize), sign, fmtSize(change))
+}
+
+func blobUrl(repo, commit, path string) string {
+	return unixpath.Join("/api/blob", repo, commit, base64.URLEncoding.EncodeToString([]byte(path)))
+}
+
+// treeUrl and fileUrl escape every path segment, so that revisions and
+// paths with special characters survive the round trip.
+func treeUrl(repo, rev, path string) string {
+	return browseUrl("tree", repo, rev, path)
+}
+
+func fileUrl(repo, rev, path string) string {
+	return browseUrl("blob", repo, rev, path)
+}
+
+func blameUrl(repo, rev, path string) string {
+	return browseUrl("blame", repo, rev, path)
+}
+
+func browseUrl(kind, repo, rev, path string) string {
+	segments := []string{"", "repos", url.PathEscape(repo), kind, url.PathEscape(rev)}
+	if path != "" {
+		for _, segment := range strings.Split(path, "/") {
+			segments = append(segments, url.PathEscape(segment))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func historyUrl(repo, rev, path string) string {
+	return browseUrl("history", repo, rev, path)
+}
+
+func commitUrl(repo, hash string) string {
+	return "/repos/" + url.PathEscape(repo) + "/commit/" + url.PathEscape(hash)
+}
+
+func compareUrl(repo, a, b string) string {
+	return "/compare/" + url.PathEscape(repo) + "/" + url.PathEscape(a) + "/" + url.PathEscape(b)
+}
+
+// fmtAge formats the time since t in the largest fitting unit, like "3 days ago".
+func fmtAge(t time.Time) string {
+	age := time.Since(t)
+	for _, unit := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	} {
+		if n := int(age / unit.duration); n == 1 {
+			return "1 " + unit.name + " ago"
+		} else if n > 1 {
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+	return "just now"
+}
+
+func compareFileUrl(repo, a, b, path string) string {
+	return unixpath.Join("/compare", repo, a, b, "file", base64.URLEncoding.EncodeToString([]byte(path)))
+}
+
+func compareSymbolsUrl(repo, a, b string) string {
+	return unixpath.Join("/compare", repo, a, b, "symbols")
+}